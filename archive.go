@@ -0,0 +1,468 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Archive 压缩包工具，Tar 和 Zip 实现了此接口
+type Archive interface {
+	// Unpack 解压缩文件到指定目录
+	Unpack(archiveFile string, targetDir string) error
+
+	// List 返回压缩包中会被解压的文件的信息，不会解压
+	List(archiveFile string) ([]ArchiveEntry, error)
+
+	// Pack 将文件或者目录打包为 archiveFile
+	Pack(archiveFile string, srcs ...string) error
+}
+
+// EntryType 压缩包中文件的类型
+type EntryType string
+
+const (
+	EntryFile     EntryType = "file"
+	EntryDir      EntryType = "dir"
+	EntrySymlink  EntryType = "symlink"
+	EntryHardlink EntryType = "hardlink"
+	EntryOther    EntryType = "other"
+)
+
+// ArchiveEntry 压缩包中的一个文件的信息
+type ArchiveEntry struct {
+	// Name 压缩包中的文件名
+	Name string
+
+	// Path 解压后相对于目标目录的路径，以 / 分隔，是 StripComponents 之后的结果
+	Path string
+
+	// Type 文件类型
+	Type EntryType
+
+	// Size 文件大小
+	Size int64
+
+	// Mode 文件的权限和类型
+	Mode os.FileMode
+
+	// ModTime 修改时间
+	ModTime time.Time
+
+	// Linkname 符号链接或者硬链接的目标
+	Linkname string
+}
+
+func entryType(mode os.FileMode) EntryType {
+	switch {
+	case mode.IsRegular():
+		return EntryFile
+	case mode.IsDir():
+		return EntryDir
+	case mode&os.ModeSymlink != 0:
+		return EntrySymlink
+	default:
+		return EntryOther
+	}
+}
+
+var _ Archive = (*Tar)(nil)
+var _ Archive = (*Zip)(nil)
+
+// ErrUnknownArchive 无法识别压缩包的格式
+var ErrUnknownArchive = errors.New("unknown archive format")
+
+// UnpackOption Unpack 的参数，对于所有格式的压缩包都有效
+type UnpackOption struct {
+	// StripComponents 忽略掉前 N 层目录
+	StripComponents uint
+
+	// MinSize 最小文件大小，>0 时有效
+	MinSize int64
+
+	// MaxSize 最大文件大小，>0 时有效
+	MaxSize int64
+
+	// Limit 解压时的限制，用于防止压缩炸弹，可选
+	Limit UnpackLimit
+
+	// IgnoreFailed 是否忽略异常，不会忽略超出 Limit 的 error
+	IgnoreFailed bool
+}
+
+// List 返回压缩包中会被解压的文件的信息，opt 可以为 nil，压缩包的格式和 Unpack 一样自动识别
+func List(archiveFile string, opt *UnpackOption) ([]ArchiveEntry, error) {
+	ac, err := newArchive(archiveFile, opt)
+	if err != nil {
+		return nil, err
+	}
+	return ac.List(archiveFile)
+}
+
+// Unpack 解压缩文件到指定目录，opt 可以为 nil
+//
+// 按照文件内容而不是后缀识别压缩包的格式，支持 zip，
+// 以及未压缩或者使用 gzip、bzip2、xz、zstd 压缩的 tar 包
+func Unpack(archiveFile string, targetDir string, opt *UnpackOption) error {
+	ac, err := newArchive(archiveFile, opt)
+	if err != nil {
+		return err
+	}
+	return ac.Unpack(archiveFile, targetDir)
+}
+
+func newArchive(archiveFile string, opt *UnpackOption) (Archive, error) {
+	if opt == nil {
+		opt = &UnpackOption{}
+	}
+	isZip, err := detectArchive(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	if isZip {
+		return &Zip{
+			StripComponents: opt.StripComponents,
+			MinSize:         opt.MinSize,
+			MaxSize:         opt.MaxSize,
+			Limit:           opt.Limit,
+			IgnoreFailed:    opt.IgnoreFailed,
+		}, nil
+	}
+	return &Tar{
+		StripComponents: opt.StripComponents,
+		MinSize:         opt.MinSize,
+		MaxSize:         opt.MaxSize,
+		Limit:           opt.Limit,
+		IgnoreFailed:    opt.IgnoreFailed,
+	}, nil
+}
+
+var (
+	magicZip      = []byte("PK\x03\x04")
+	magicZipEmpty = []byte("PK\x05\x06")
+	magicTar      = []byte("ustar")
+)
+
+// tarMagicOffset tar Header 中 magic 的位置
+const tarMagicOffset = 257
+
+// detectArchive 按照文件开头的内容识别压缩包的格式，返回是否是 zip，
+// 若不是 zip，则是 tar 包（可能是压缩过的），都不是时返回 ErrUnknownArchive
+func detectArchive(archiveFile string) (isZip bool, err error) {
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, magicZip), bytes.HasPrefix(head, magicZipEmpty):
+		return true, nil
+	case isCompressed(head):
+		return false, nil
+	case len(head) >= tarMagicOffset+len(magicTar) &&
+		bytes.Equal(head[tarMagicOffset:tarMagicOffset+len(magicTar)], magicTar):
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %s", ErrUnknownArchive, archiveFile)
+}
+
+// UnsafePathError 解压时，压缩包中的文件路径或者链接目标不安全，如会写入到目标目录之外
+type UnsafePathError struct {
+	// Name 压缩包中的文件名
+	Name string
+
+	// Path 不安全的路径，是文件名自身或者链接的目标
+	Path string
+}
+
+func (e *UnsafePathError) Error() string {
+	if e.Path == e.Name {
+		return fmt.Sprintf("archive entry %q has unsafe path", e.Name)
+	}
+	return fmt.Sprintf("archive entry %q has unsafe link target %q", e.Name, e.Path)
+}
+
+// checkEntryName 检查压缩包中的文件名是否是安全的相对路径：
+// 不能为空、不能是绝对路径、不能包含 \ 以及 .. 路径
+func checkEntryName(name string) error {
+	if !isLocalSlashPath(strings.TrimSuffix(name, "/")) {
+		return &UnsafePathError{Name: name, Path: name}
+	}
+	return nil
+}
+
+// isLocalSlashPath 判断以 / 分隔的路径 p 是否是不包含 .. 的相对路径
+func isLocalSlashPath(p string) bool {
+	if len(p) == 0 || strings.HasPrefix(p, "/") || strings.Contains(p, `\`) ||
+		filepath.IsAbs(p) || len(filepath.VolumeName(p)) > 0 {
+		return false
+	}
+	for _, item := range strings.Split(p, "/") {
+		if item == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// securePath 返回文件在 root 目录下的路径，name 是以 / 分隔的相对路径
+//
+// 除了检查 name 自身外，还会解析路径上已存在的符号链接，
+// 若最终的路径在 root 之外，则返回 *UnsafePathError
+func securePath(root string, name string, entry string) (string, error) {
+	if !isLocalSlashPath(name) {
+		return "", &UnsafePathError{Name: entry, Path: entry}
+	}
+	abs := filepath.Join(root, filepath.FromSlash(name))
+	if err := checkWithinRoot(root, abs); err != nil {
+		return "", &UnsafePathError{Name: entry, Path: entry}
+	}
+	return abs, nil
+}
+
+// checkLinkTarget 检查位于 abs 的符号链接的目标 link 是否在 root 目录内
+//
+// 系统在解析链接时，会先解析 .. 之前的符号链接，和按照字面处理 .. 的结果可能不同，
+// 所以 link 中的 .. 只允许出现在最前面，并且基于 abs 所在目录的真实路径来判断
+func checkLinkTarget(root string, abs string, link string, entry string) error {
+	if len(link) == 0 || strings.HasPrefix(link, "/") || strings.Contains(link, `\`) ||
+		filepath.IsAbs(link) || len(filepath.VolumeName(link)) > 0 {
+		return &UnsafePathError{Name: entry, Path: link}
+	}
+	var named bool
+	for _, item := range strings.Split(link, "/") {
+		if item == ".." {
+			if named {
+				return &UnsafePathError{Name: entry, Path: link}
+			}
+		} else if item != "." && item != "" {
+			named = true
+		}
+	}
+
+	realRoot, err := evalExistingSymlinks(root)
+	if err != nil {
+		return &UnsafePathError{Name: entry, Path: link}
+	}
+	realDir, err := evalExistingSymlinks(filepath.Dir(abs))
+	if err != nil || !isWithinDir(realRoot, realDir) {
+		return &UnsafePathError{Name: entry, Path: link}
+	}
+	if err = checkWithinRoot(realRoot, filepath.Join(realDir, filepath.FromSlash(link))); err != nil {
+		return &UnsafePathError{Name: entry, Path: link}
+	}
+	return nil
+}
+
+// checkWithinRoot 解析 p 和 root 上已存在的符号链接后，检查 p 是否在 root 目录内
+func checkWithinRoot(root string, p string) error {
+	if !isWithinDir(root, p) {
+		return fmt.Errorf("%q is outside of %q", p, root)
+	}
+	realRoot, err := evalExistingSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realPath, err := evalExistingSymlinks(p)
+	if err != nil {
+		return err
+	}
+	if !isWithinDir(realRoot, realPath) {
+		return fmt.Errorf("%q is outside of %q", p, root)
+	}
+	return nil
+}
+
+// evalExistingSymlinks 解析 p 中已存在的部分的符号链接，不存在的部分保持不变
+//
+// 对于悬空的符号链接（目标不存在），会继续解析其目标，
+// 因为以 O_CREATE 打开这样的路径时，会在链接的目标位置创建文件
+func evalExistingSymlinks(p string) (string, error) {
+	for range 255 {
+		var err error
+		if p, err = filepath.Abs(p); err != nil {
+			return "", err
+		}
+		var rest []string
+		var link string
+		for {
+			real, err := filepath.EvalSymlinks(p)
+			if err == nil {
+				return filepath.Join(append([]string{real}, rest...)...), nil
+			}
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+			if info, err1 := os.Lstat(p); err1 == nil && info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(p); err != nil {
+					return "", err
+				}
+				if !filepath.IsAbs(link) {
+					link = filepath.Join(filepath.Dir(p), link)
+				}
+				break
+			}
+			parent := filepath.Dir(p)
+			if parent == p {
+				return "", err
+			}
+			rest = append([]string{filepath.Base(p)}, rest...)
+			p = parent
+		}
+		p = filepath.Join(append([]string{link}, rest...)...)
+	}
+	return "", fmt.Errorf("%w: %s", ErrSymlinkLoop, p)
+}
+
+// isWithinDir 按照字面判断 p 是否在 dir 目录内（包括 dir 自身）
+func isWithinDir(dir string, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// ratioCheckMinSize 解压后的数据超过此大小后才检查压缩比，以避免小文件因为压缩率高而误判
+const ratioCheckMinSize = 1 << 20
+
+// UnpackLimit 解压时的限制，用于防止压缩炸弹，各字段 >0 时有效
+type UnpackLimit struct {
+	// MaxTotalSize 解压后所有文件的总大小的最大值，按照实际写入的字节数计算
+	MaxTotalSize int64
+
+	// MaxEntries 压缩包中文件（包括目录、链接等）数量的最大值
+	MaxEntries int
+
+	// MaxRatio 单个文件解压后大小和压缩后大小的比值的最大值，只在解压后大于 1MB 时检查
+	// 对于 tar 包，由于文件不是单独压缩的，按照已解压的总大小和已读取的压缩数据的大小计算，
+	// 并且只在使用 Unpack 时有效
+	MaxRatio float64
+
+	// MaxDepth 文件路径的目录层级的最大值，按照 StripComponents 之后的路径计算
+	MaxDepth int
+}
+
+// LimitError 解压时超出了 UnpackLimit 的限制
+type LimitError struct {
+	// Name 压缩包中的文件名
+	Name string
+
+	// Limit 超出的限制，如 "MaxTotalSize"
+	Limit string
+
+	// Max 限制的值
+	Max float64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("archive entry %q exceeds %s limit (%v)", e.Name, e.Limit, e.Max)
+}
+
+// isLimitError 判断 err 是否是 *LimitError，此类错误不会被 IgnoreFailed 忽略
+func isLimitError(err error) bool {
+	var le *LimitError
+	return errors.As(err, &le)
+}
+
+// unpackLimiter 一次解压的限制检查状态
+type unpackLimiter struct {
+	limit   UnpackLimit
+	entries int
+	total   int64
+
+	// stream 整个压缩数据流，用于计算 tar 包的压缩比，可以为 nil
+	stream *countReader
+}
+
+// checkEntry 检查文件数量，以及文件路径 to（以 / 分隔）的层级
+func (ul *unpackLimiter) checkEntry(name string, to string) error {
+	ul.entries++
+	if ul.limit.MaxEntries > 0 && ul.entries > ul.limit.MaxEntries {
+		return &LimitError{Name: name, Limit: "MaxEntries", Max: float64(ul.limit.MaxEntries)}
+	}
+	to = strings.Trim(to, "/")
+	if ul.limit.MaxDepth > 0 && len(to) > 0 && to != "." {
+		if depth := strings.Count(to, "/") + 1; depth > ul.limit.MaxDepth {
+			return &LimitError{Name: name, Limit: "MaxDepth", Max: float64(ul.limit.MaxDepth)}
+		}
+	}
+	return nil
+}
+
+// checkRatio 检查解压后的大小 size 和压缩后的大小 compressed 的比值
+func (ul *unpackLimiter) checkRatio(name string, size int64, compressed int64) error {
+	if ul.limit.MaxRatio <= 0 || size < ratioCheckMinSize {
+		return nil
+	}
+	if float64(size) > ul.limit.MaxRatio*float64(max(compressed, 1)) {
+		return &LimitError{Name: name, Limit: "MaxRatio", Max: ul.limit.MaxRatio}
+	}
+	return nil
+}
+
+// reader 返回一个读取时会检查总大小和压缩比的 Reader
+//
+// compressed 返回此文件压缩后的大小，可以为 nil
+func (ul *unpackLimiter) reader(name string, rd io.Reader, compressed func() int64) io.Reader {
+	return &limitReader{
+		rd:         rd,
+		ul:         ul,
+		name:       name,
+		compressed: compressed,
+	}
+}
+
+type limitReader struct {
+	rd         io.Reader
+	ul         *unpackLimiter
+	name       string
+	n          int64
+	compressed func() int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	n, err := lr.rd.Read(p)
+	lr.n += int64(n)
+	lr.ul.total += int64(n)
+	if max := lr.ul.limit.MaxTotalSize; max > 0 && lr.ul.total > max {
+		return n, &LimitError{Name: lr.name, Limit: "MaxTotalSize", Max: float64(max)}
+	}
+	var err1 error
+	if lr.ul.stream != nil {
+		err1 = lr.ul.checkRatio(lr.name, lr.ul.total, lr.ul.stream.n)
+	} else if lr.compressed != nil {
+		err1 = lr.ul.checkRatio(lr.name, lr.n, lr.compressed())
+	}
+	if err1 != nil {
+		return n, err1
+	}
+	return n, err
+}
+
+// countReader 记录已读取的字节数
+type countReader struct {
+	rd io.Reader
+	n  int64
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.rd.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
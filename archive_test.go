@@ -0,0 +1,119 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/xanygo/anygo/xt"
+)
+
+func TestCheckEntryName(t *testing.T) {
+	for _, name := range []string{"a", "a/b", "a/", "./a", "./", "a..b", "..a/b"} {
+		xt.NoError(t, checkEntryName(name))
+	}
+	for _, name := range []string{"", "..", "../", "../a", "a/..", "a/../b", "/a", `a\b`, "a/../../b"} {
+		err := checkEntryName(name)
+		var ue *UnsafePathError
+		xt.True(t, errors.As(err, &ue))
+	}
+}
+
+func TestSecurePath(t *testing.T) {
+	if isWindows() {
+		t.Skip("symlink not supported")
+	}
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	xt.NoError(t, mkdir(filepath.Join(root, "in")))
+	xt.NoError(t, mkdir(filepath.Join(dir, "outside")))
+	xt.NoError(t, os.Symlink("../outside", filepath.Join(root, "out")))
+	xt.NoError(t, os.Symlink("in", filepath.Join(root, "in_link")))
+	xt.NoError(t, os.Symlink("../outside/not-exists", filepath.Join(root, "dangling")))
+
+	got, err := securePath(root, "in_link/a.txt", "in_link/a.txt")
+	xt.NoError(t, err)
+	xt.Equal(t, filepath.Join(root, "in_link", "a.txt"), got)
+
+	_, err = securePath(root, "new/a.txt", "new/a.txt")
+	xt.NoError(t, err)
+
+	for _, name := range []string{"out/a.txt", "out", "dangling", "dangling/a.txt", "../root/a"} {
+		_, err = securePath(root, name, name)
+		var ue *UnsafePathError
+		xt.True(t, errors.As(err, &ue))
+	}
+
+	xt.NoError(t, mkdir(filepath.Join(root, "in", "deep")))
+	xt.NoError(t, os.Symlink("in/deep", filepath.Join(root, "deep_link")))
+	xt.NoError(t, os.Symlink(".", filepath.Join(root, "self")))
+
+	xt.NoError(t, checkLinkTarget(root, filepath.Join(root, "in", "x"), "../in_link/a", "x"))
+	xt.NoError(t, checkLinkTarget(root, filepath.Join(root, "deep_link", "x"), "../../in/a", "x"))
+	for _, link := range []string{"../out/a", "a/../../x", "/a", "", "../../x"} {
+		xt.Error(t, checkLinkTarget(root, filepath.Join(root, "in", "x"), link, "x"))
+	}
+	// 按照字面是 root/x，但是系统解析时 self 指向 root，所以实际是 root 的上级目录
+	xt.Error(t, checkLinkTarget(root, filepath.Join(root, "self", "x"), "../x", "x"))
+}
+
+func TestUnpack(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b")
+
+	packs := map[string]Archive{
+		"tar": &Tar{},
+		"tgz": &Tar{
+			Compress: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriter(w), nil
+			},
+		},
+		"zst": &Tar{
+			Compress: func(w io.Writer) (io.WriteCloser, error) {
+				return zstd.NewWriter(w)
+			},
+		},
+		"zip": &Zip{},
+	}
+	for name, ac := range packs {
+		t.Run(name, func(t *testing.T) {
+			// 文件名没有后缀，只能按照内容识别
+			archive := filepath.Join(dir, "archive-"+name)
+			xt.NoError(t, ac.Pack(archive, src))
+
+			list, err := List(archive, &UnpackOption{StripComponents: 1})
+			xt.NoError(t, err)
+			var paths []string
+			for _, e := range list {
+				paths = append(paths, e.Path)
+			}
+			xt.Equal(t, []string{"a.txt", "sub", "sub/b.txt"}, paths)
+
+			out := filepath.Join(dir, "out-"+name)
+			xt.NoError(t, Unpack(archive, out, &UnpackOption{StripComponents: 1, MaxSize: 10}))
+			xt.Equal(t, "a", readTestFile(t, filepath.Join(out, "a.txt")))
+			xt.Equal(t, "b", readTestFile(t, filepath.Join(out, "sub", "b.txt")))
+
+			err = Unpack(archive, t.TempDir(), &UnpackOption{Limit: UnpackLimit{MaxEntries: 1}})
+			var le *LimitError
+			xt.True(t, errors.As(err, &le))
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		fp := filepath.Join(dir, "unknown.zip")
+		writeTestFile(t, fp, "hello")
+		err := Unpack(fp, t.TempDir(), nil)
+		xt.True(t, errors.Is(err, ErrUnknownArchive))
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// bzip2 的第一个 block 的 magic，以及没有 block 时的结束 magic
+	magicBzip2Block = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	magicBzip2End   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// magicHeadLen 识别压缩格式需要的数据长度
+const magicHeadLen = 10
+
+// isBzip2 判断是否是 bzip2 数据："BZh"、压缩级别 1-9，之后是 block 或者结束的 magic
+//
+// 只判断 "BZh" 的话，第一个文件名以 "BZh" 开头的未压缩的 tar 也会被认为是 bzip2
+func isBzip2(head []byte) bool {
+	if len(head) < magicHeadLen || !bytes.HasPrefix(head, magicBzip2) || head[3] < '1' || head[3] > '9' {
+		return false
+	}
+	return bytes.Equal(head[4:10], magicBzip2Block) || bytes.Equal(head[4:10], magicBzip2End)
+}
+
+// isCompressed 判断数据是否是支持的压缩格式
+func isCompressed(head []byte) bool {
+	return bytes.HasPrefix(head, magicGzip) || isBzip2(head) ||
+		bytes.HasPrefix(head, magicXz) || bytes.HasPrefix(head, magicZstd)
+}
+
+// unCompressByMagic 按照数据开头的 magic bytes 识别压缩格式，返回解压后的 Reader
+//
+// 支持 gzip、bzip2、xz、zstd，都不是时认为数据未压缩，返回原始数据。
+// 若返回的 Reader 实现了 io.Closer，使用完后需要 Close
+func unCompressByMagic(rd io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(rd)
+	head, err := br.Peek(magicHeadLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return gzip.NewReader(br)
+	case isBzip2(head):
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(head, magicXz):
+		return xz.NewReader(br)
+	case bytes.HasPrefix(head, magicZstd):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return br, nil
+	}
+}
@@ -4,10 +4,696 @@
 
 package cmdutil
 
-// CP todo
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrSymlinkLoop 复制时跟随符号链接出现了循环
+var ErrSymlinkLoop = errors.New("symlink loop")
+
+// SymlinkMode 复制时对符号链接的处理方式
+type SymlinkMode int8
+
+const (
+	// SymlinkKeep 保持为符号链接，链接的目标保持不变，同 cp -P，默认值
+	SymlinkKeep SymlinkMode = iota
+
+	// SymlinkFollow 跟随符号链接，复制其指向的文件或者目录，同 cp -L
+	SymlinkFollow
+
+	// SymlinkSkip 忽略符号链接，不复制
+	SymlinkSkip
+)
+
+// CP 复制文件或者目录，功能类似 cp -r 命令
 type CP struct {
+	// Symlink 对符号链接的处理方式，可选，默认为 SymlinkKeep
+	Symlink SymlinkMode
+
+	// PreserveMode 是否保留文件权限（包括 setuid、setgid、sticky 位），可选
+	// 默认新文件的权限为源文件权限去掉 umask 后的值，已存在的文件保持原有权限
+	PreserveMode bool
+
+	// PreserveTimes 是否保留文件的修改时间和访问时间，可选
+	// 符号链接自身的时间不会被保留
+	PreserveTimes bool
+
+	// PreserveOwner 是否保留文件的 uid、gid，可选
+	// 只在以 root 用户运行时有效，其他情况会忽略
+	//
+	// 同时设置 PreserveMode、PreserveTimes、PreserveOwner 的效果同 cp -p
+	PreserveOwner bool
+
+	// CopyNextBefore 在 Copy 时，读取到下一个文件或者目录后，实际 copy 前的回调
+	// 若 skip=true，则忽略该文件，若是目录，则整个目录都会被忽略
+	CopyNextBefore func(src string, dst string, info os.FileInfo) (skip bool, err error)
+
+	// CopyNextAfter 在 Copy 时，读取到下一个文件或者目录后，实际 copy 后的回调
+	// 对于目录，会在目录下所有文件都处理完成后才回调
+	CopyNextAfter func(src string, dst string, info os.FileInfo, err error) error
+
+	// Include 需要复制的文件的匹配规则列表，可选，为空时表示所有文件
+	// 只对非目录有效，规则同 path.Match，会同时匹配文件名和相对于 src 的路径（以 / 分隔）
+	// 如 "*.go"、"cmd/*.go"
+	Include []string
+
+	// Exclude 不需要复制的文件或者目录的匹配规则列表，可选，规则同 Include
+	// 匹配到的目录会整个被忽略
+	Exclude []string
+
+	// MinSize 最小文件大小，>0 时有效
+	MinSize int64
+
+	// MaxSize 最大文件大小，>0 时有效
+	MaxSize int64
+
+	// IgnoreFailed 是否忽略异常
+	// 不会忽略 CopyNextBefore 返回的 error
+	IgnoreFailed bool
+
+	// Compare 目标文件已存在时，判断是否需要复制的方式，可选，默认为 CompareNone，总是复制
+	Compare CompareMode
+
+	// Delete 是否删除目标目录中，在源目录中不存在的文件或者目录，同 rsync --delete，可选
+	// 匹配 Exclude、Include 等过滤规则而被忽略的文件不会被删除
+	Delete bool
+
+	// DryRun 是否只生成执行计划，而不实际修改文件系统，可选
+	// 为 true 时，Sync 返回的 CPResult.Actions 是将要执行的操作列表，Added、Updated、Removed
+	// 是将要新增、更新、删除的文件。CopyNextBefore 依然会被调用，CopyNextAfter 不会被调用
+	DryRun bool
+
+	// Atomic 是否原子的写入文件，可选
+	// 为 true 时，文件内容会先写入到同目录下的临时文件，在 fsync 之后再重命名为目标文件，
+	// 这样复制失败或者中途退出时，目标路径上不会出现只写了一部分的文件
+	Atomic bool
+
+	// Concurrency 并发复制文件的数量，可选，<=1 时为串行复制
+	//
+	// 并发时目录依然会按顺序创建，文件的复制由 WorkerGroup 并发执行，
+	// 目录的权限、时间等信息会在所有文件都复制完成后再设置。
+	// 出现不可忽略的错误后，不会再开始新的复制，最终返回的是按照遍历顺序最先出现的错误，
+	// 此时还没有处理完成的目录不会再回调 CopyNextAfter。
+	// CopyNextAfter 会在多个 goroutine 中被调用，但不会被同时调用
+	Concurrency int
 }
 
+// Copy 复制文件或者目录到 dst，规则同 cp -r：
+//
+//  1. 只有一个 src 时，若 dst 是已存在的目录，则复制为 dst/{src 的文件名}，否则复制为 dst
+//  2. 有多个 src 时，dst 必须是已存在的目录，每个 src 都复制到 dst/{src 的文件名}
+//
+// dst 的上级目录若不存在会自动创建
 func (cp *CP) Copy(dst string, srcs ...string) error {
+	_, err := cp.Sync(dst, srcs...)
+	return err
+}
+
+// Sync 同 Copy，并返回新增、更新、删除了的文件和目录
+//
+// 配合 Compare 和 Delete 选项，可以实现类似 rsync 的增量同步。
+// 和 cp -r 一样，若 dst 是已存在的目录，src 会被同步到 dst/{src 的文件名}，
+// 若需要将 src 目录下的内容同步到 dst，src 可以使用 "src/." 的形式
+func (cp *CP) Sync(dst string, srcs ...string) (*CPResult, error) {
+	if len(srcs) == 0 {
+		return nil, errors.New("missing source path")
+	}
+	if len(dst) == 0 {
+		return nil, errors.New("empty destination path")
+	}
+	if err := cp.checkPatterns(); err != nil {
+		return nil, err
+	}
+
+	var dstIsDir bool
+	if info, err := os.Stat(dst); err == nil {
+		dstIsDir = info.IsDir()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(srcs) > 1 && !dstIsDir {
+		return nil, fmt.Errorf("target %q is not a directory", dst)
+	}
+
+	cj := newCPJob(cp)
+	err := cj.copyAll(dst, dstIsDir, srcs)
+	err = cj.wait(err)
+	cj.result.sort()
+
+	var he *cpHookError
+	if errors.As(err, &he) {
+		return cj.result, he.err
+	}
+	return cj.result, err
+}
+
+// cpJob 一次 Copy 或 Sync 调用的状态
+type cpJob struct {
+	*CP
+	result *CPResult
+
+	// 以下字段只在并发复制时使用
+	wg      *WorkerGroup
+	seq     int             // 已提交的并发任务数，只在遍历的 goroutine 中读写
+	dirs    []cpPendingMeta // 待所有文件复制完成后再设置元信息和回调 CopyNextAfter 的目录
+	stopped atomic.Bool
+	errIdx  int
+	err     error
+
+	mu     sync.Mutex // 保护 result、errIdx、err
+	hookMu sync.Mutex // 保证 CopyNextAfter 不会被同时调用
+}
+
+type cpPendingMeta struct {
+	src  string
+	dst  string
+	info os.FileInfo
+}
+
+func newCPJob(cp *CP) *cpJob {
+	cj := &cpJob{
+		CP:     cp,
+		result: &CPResult{},
+	}
+	if cp.Concurrency > 1 && !cp.DryRun {
+		cj.wg = &WorkerGroup{Max: cp.Concurrency}
+	}
+	return cj
+}
+
+func (cj *cpJob) copyAll(dst string, dstIsDir bool, srcs []string) error {
+	for _, src := range srcs {
+		to := dst
+		if dstIsDir {
+			to = filepath.Join(dst, filepath.Base(src))
+		} else if err := cj.mkdirParent(filepath.Dir(dst)); err != nil {
+			return err
+		}
+		if err := cj.copyOne(src, to, "", nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goCopy 并发执行复制任务，若已有按遍历顺序更靠前的任务失败，则不再执行
+func (cj *cpJob) goCopy(fn func() error) {
+	idx := cj.seq
+	cj.seq++
+	cj.wg.Run(func() {
+		if cj.failedBefore(idx) {
+			return
+		}
+		if err := fn(); err != nil {
+			cj.setErr(idx, err)
+		}
+	})
+}
+
+func (cj *cpJob) failedBefore(idx int) bool {
+	if !cj.stopped.Load() {
+		return false
+	}
+	cj.mu.Lock()
+	defer cj.mu.Unlock()
+	return cj.errIdx < idx
+}
+
+func (cj *cpJob) setErr(idx int, err error) {
+	cj.mu.Lock()
+	defer cj.mu.Unlock()
+	if cj.err == nil || idx < cj.errIdx {
+		cj.errIdx = idx
+		cj.err = err
+	}
+	cj.stopped.Store(true)
+}
+
+// wait 等待所有的并发任务完成，并返回按遍历顺序最先出现的错误
+func (cj *cpJob) wait(err error) error {
+	if cj.wg == nil {
+		return err
+	}
+	if err != nil && !errors.Is(err, errCPStopped) {
+		// 遍历时的错误，出现在所有已提交的任务之后
+		cj.setErr(cj.seq, err)
+	}
+	cj.wg.Wait()
+	if cj.err != nil {
+		return cj.err
+	}
+	// 子目录在上级目录之前添加，按顺序处理即可
+	for _, dm := range cj.dirs {
+		if err = cj.copyAfter(dm.src, dm.dst, dm.info, cj.preserve(dm.dst, dm.info)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errCPStopped 并发复制时，已有任务失败，停止遍历
+var errCPStopped = errors.New("copy stopped")
+
+// cpHookError CopyNextBefore 返回的 error，不会被 IgnoreFailed 忽略
+type cpHookError struct {
+	err error
+}
+
+func (e *cpHookError) Error() string {
+	return e.err.Error()
+}
+
+func (e *cpHookError) Unwrap() error {
+	return e.err
+}
+
+func (cp *CP) checkPatterns() error {
+	for _, ps := range [][]string{cp.Include, cp.Exclude} {
+		for _, p := range ps {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (cp *CP) matchAny(patterns []string, name string, rel string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+		if len(rel) != 0 {
+			if ok, _ := path.Match(p, rel); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkIgnore 判断是否需要忽略此文件，rel 是相对于 src 的路径，对于 src 自身为空
+func (cp *CP) checkIgnore(name string, rel string, info os.FileInfo) bool {
+	if cp.matchAny(cp.Exclude, name, rel) {
+		return true
+	}
+	if info.IsDir() {
+		return false
+	}
+	if len(cp.Include) > 0 && !cp.matchAny(cp.Include, name, rel) {
+		return true
+	}
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	if cp.MinSize > 0 && info.Size() < cp.MinSize {
+		return true
+	}
+	if cp.MaxSize > 0 && info.Size() > cp.MaxSize {
+		return true
+	}
+	return false
+}
+
+// copyOne 复制一个文件或者目录
+//
+// rel 是相对于最初的 src 的路径，parents 是 src 的所有上级目录，用于检测循环
+func (cj *cpJob) copyOne(src string, dst string, rel string, parents []os.FileInfo) error {
+	if cj.stopped.Load() {
+		return errCPStopped
+	}
+	info, err := cj.lstat(src)
+	if err != nil {
+		return cj.checkFailed(err)
+	}
+	if info == nil || cj.checkIgnore(filepath.Base(src), rel, info) {
+		cj.record(CPOpSkip, src, dst)
+		return nil
+	}
+
+	if cj.CopyNextBefore != nil {
+		if skip, err4 := cj.CopyNextBefore(src, dst, info); skip {
+			cj.record(CPOpSkip, src, dst)
+			return nil
+		} else if err4 != nil {
+			return &cpHookError{err: err4}
+		}
+	}
+
+	if cj.wg != nil {
+		switch {
+		case info.Mode().IsRegular():
+			cj.goCopy(func() error {
+				return cj.copyAfter(src, dst, info, cj.copyRegular(src, dst, info))
+			})
+			return nil
+		case info.IsDir():
+			return cj.copyDirConcurrent(src, dst, rel, info, parents)
+		}
+	}
+	return cj.copyAfter(src, dst, info, cj.copyEntry(src, dst, rel, info, parents))
+}
+
+// copyDirConcurrent 并发复制时复制目录，目录下的文件可能还没有复制完成，
+// 成功时在 wait 中回调 CopyNextAfter，失败时等待已开始的复制完成后再回调
+func (cj *cpJob) copyDirConcurrent(src string, dst string, rel string, info os.FileInfo, parents []os.FileInfo) error {
+	err := cj.copyEntry(src, dst, rel, info, parents)
+	if err == nil || errors.Is(err, errCPStopped) {
+		return err
+	}
+	cj.wg.Wait()
+	return cj.copyAfter(src, dst, info, err)
+}
+
+func (cj *cpJob) copyAfter(src string, dst string, info os.FileInfo, err error) error {
+	if cj.CopyNextAfter != nil && !cj.DryRun {
+		cj.hookMu.Lock()
+		err = cj.CopyNextAfter(src, dst, info, err)
+		cj.hookMu.Unlock()
+	}
+	return cj.checkFailed(err)
+}
+
+func (cp *CP) checkFailed(err error) error {
+	if err == nil || !cp.IgnoreFailed {
+		return err
+	}
+	var he *cpHookError
+	if errors.As(err, &he) || errors.Is(err, errCPStopped) {
+		return err
+	}
+	return nil
+}
+
+// lstat 读取文件信息，并按照 Symlink 的配置处理符号链接，若返回的 info 为 nil，则表示需要忽略
+func (cp *CP) lstat(src string) (os.FileInfo, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return info, nil
+	}
+	switch cp.Symlink {
+	case SymlinkSkip:
+		return nil, nil
+	case SymlinkFollow:
+		if info, err = os.Stat(src); err != nil {
+			if isSymlinkLoopErr(err) {
+				return nil, fmt.Errorf("%w: %s", ErrSymlinkLoop, src)
+			}
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+func (cj *cpJob) copyEntry(src string, dst string, rel string, info os.FileInfo, parents []os.FileInfo) error {
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		for _, p := range parents {
+			if os.SameFile(p, info) {
+				return fmt.Errorf("%w: %s", ErrSymlinkLoop, src)
+			}
+		}
+		return cj.copyDir(src, dst, rel, info, parents)
+	case mode.IsRegular():
+		return cj.copyRegular(src, dst, info)
+	case mode&os.ModeSymlink != 0:
+		return cj.copySymlink(src, dst, info)
+	default:
+		return fmt.Errorf("cannot copy %q: unsupported file type %v", src, mode)
+	}
+}
+
+func (cj *cpJob) copyDir(src string, dst string, rel string, info os.FileInfo, parents []os.FileInfo) error {
+	if err := cj.checkIntoItself(src, dst); err != nil {
+		return err
+	}
+
+	di, err := os.Stat(dst)
+	dstExists := err == nil
+	if dstExists {
+		if !di.IsDir() {
+			return fmt.Errorf("cannot overwrite non-directory %q with directory %q", dst, src)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	} else {
+		if !cj.DryRun {
+			if err = mkdir(dst); err != nil {
+				return err
+			}
+		}
+		cj.record(CPOpMkdir, src, dst)
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if cj.Delete && dstExists {
+		if err = cj.deleteExtra(dst, rel, entries); err != nil {
+			return err
+		}
+	}
+
+	parents = append(parents[:len(parents):len(parents)], info)
+	for _, entry := range entries {
+		name := entry.Name()
+		if err = cj.copyOne(filepath.Join(src, name), filepath.Join(dst, name), path.Join(rel, name), parents); err != nil {
+			return err
+		}
+	}
+	// 在复制完所有子文件后再设置，以避免目录的修改时间被子文件的写入改变，
+	// 以及目录没有写权限时后续的子文件写入失败
+	if cj.wg != nil {
+		cj.dirs = append(cj.dirs, cpPendingMeta{src: src, dst: dst, info: info})
+		return nil
+	}
+	return cj.preserve(dst, info)
+}
+
+// checkIntoItself 检查是否是将目录复制到其自身或者子目录中，如 cp -r a a/b
+func (cp *CP) checkIntoItself(src string, dst string) error {
+	srcAbs, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	dstAbs, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	if dstAbs == srcAbs || strings.HasPrefix(dstAbs, srcAbs+string(filepath.Separator)) {
+		return fmt.Errorf("cannot copy a directory %q into itself %q", src, dst)
+	}
+	return nil
+}
+
+func (cj *cpJob) copyRegular(src string, dst string, info os.FileInfo) error {
+	di, err := os.Stat(dst)
+	dstExists := err == nil
+	if dstExists {
+		if di.IsDir() {
+			return fmt.Errorf("cannot overwrite directory %q with non-directory %q", dst, src)
+		}
+		if os.SameFile(info, di) {
+			return fmt.Errorf("%q and %q are the same file", src, dst)
+		}
+		same, err1 := cj.sameContent(src, dst, info, di)
+		if err1 != nil {
+			return err1
+		}
+		if same {
+			cj.record(CPOpSkip, src, dst)
+			return cj.preserve(dst, info)
+		}
+	}
+
+	if cj.DryRun {
+		cj.record(copyOp(dstExists), src, dst)
+		return nil
+	}
+
+	rf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+
+	if cj.Atomic {
+		return cj.copyRegularAtomic(rf, dst, info, di)
+	}
+
+	wf, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = copyFileData(wf, rf, info.Size()); err != nil {
+		wf.Close()
+		return fmt.Errorf("error writing to %s: %w", dst, err)
+	}
+	if err = wf.Close(); err != nil {
+		return err
+	}
+	cj.record(copyOp(dstExists), src, dst)
+	return cj.preserve(dst, info)
+}
+
+// copyRegularAtomic 先将内容写入到 dst 同目录下的临时文件，在 fsync 之后再重命名为 dst，
+// 若失败会删除临时文件。di 为已存在的 dst 的信息，若不存在则为 nil
+func (cj *cpJob) copyRegularAtomic(rf *os.File, dst string, info os.FileInfo, di os.FileInfo) (err error) {
+	tmpName, wf, err := createTempSibling(dst, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			wf.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err = copyFileData(wf, rf, info.Size()); err != nil {
+		return fmt.Errorf("error writing to %s: %w", tmpName, err)
+	}
+	if err = wf.Sync(); err != nil {
+		return err
+	}
+	if err = wf.Close(); err != nil {
+		return err
+	}
+	if di != nil && !cj.PreserveMode {
+		// 和非原子复制时一样，已存在的文件保持原有权限
+		if err = os.Chmod(tmpName, di.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if err = cj.preserve(tmpName, info); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpName, dst); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(dst))
+	cj.record(copyOp(di != nil), rf.Name(), dst)
+	return nil
+}
+
+// createTempSibling 在 name 同目录下创建一个隐藏的临时文件
+func createTempSibling(name string, perm os.FileMode) (string, *os.File, error) {
+	dir, base := filepath.Split(name)
+	for i := 0; ; i++ {
+		tmpName := filepath.Join(dir, fmt.Sprintf(".%s.%d.tmp", base, rand.Uint32()))
+		f, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if err == nil {
+			return tmpName, f, nil
+		}
+		if !os.IsExist(err) || i >= 100 {
+			return "", nil, err
+		}
+	}
+}
+
+// syncDir 尽量将目录的变更（如 rename）持久化，部分平台不支持，忽略错误
+func syncDir(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = f.Sync()
+	f.Close()
+}
+
+// cpMethod 复制文件内容的方式
+type cpMethod int8
+
+const (
+	cpByCopy    cpMethod = iota // io.Copy，在 Linux 上会尝试使用 copy_file_range 在内核中复制
+	cpByReflink                 // FICLONE，reflink
+)
+
+// copyFileData 复制文件内容，优先使用 reflink，不支持时再复制数据
+func copyFileData(dst *os.File, src *os.File, size int64) (cpMethod, error) {
+	// 如 /proc 下的文件，大小为 0，但是实际是有内容的，不能使用 reflink
+	if size > 0 && cloneFile(dst, src) {
+		return cpByReflink, nil
+	}
+	// dst 的 ReadFrom 方法在 Linux 上会优先使用 copy_file_range，不支持时再使用用户态的复制方式
+	return cpByCopy, copyFile(src, dst, size)
+}
+
+func (cj *cpJob) copySymlink(src string, dst string, info os.FileInfo) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	di, err := os.Lstat(dst)
+	dstExists := err == nil
+	if dstExists {
+		if di.IsDir() {
+			return fmt.Errorf("cannot overwrite directory %q with non-directory %q", dst, src)
+		}
+		if cj.Compare != CompareNone && di.Mode()&os.ModeSymlink != 0 {
+			if old, _ := os.Readlink(dst); old == target {
+				cj.record(CPOpSkip, src, dst)
+				return cj.preserve(dst, info)
+			}
+		}
+	}
+	if cj.DryRun {
+		cj.record(copyOp(dstExists), src, dst)
+		return nil
+	}
+	if dstExists {
+		if err = os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err = os.Symlink(target, dst); err != nil {
+		return err
+	}
+	cj.record(copyOp(dstExists), src, dst)
+	return cj.preserve(dst, info)
+}
+
+// preserve 按照配置将 info 中的 owner、权限、时间信息设置到 dst 上
+func (cp *CP) preserve(dst string, info os.FileInfo) error {
+	if cp.DryRun {
+		return nil
+	}
+	isLink := info.Mode()&os.ModeSymlink != 0
+	// 先修改 owner，因为 chown 会清除 setuid、setgid 位
+	if cp.PreserveOwner && os.Geteuid() == 0 {
+		if uid, gid, ok := fileOwner(info); ok {
+			if err := os.Lchown(dst, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	if isLink {
+		return nil
+	}
+	if cp.PreserveMode {
+		mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := os.Chmod(dst, mode); err != nil {
+			return err
+		}
+	}
+	if cp.PreserveTimes {
+		if err := os.Chtimes(dst, fileAccessTime(info), info.ModTime()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
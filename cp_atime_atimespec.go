@@ -0,0 +1,20 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+//go:build darwin || ios || freebsd || netbsd
+
+package cmdutil
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func fileAccessTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atimespec.Unix())
+	}
+	return info.ModTime()
+}
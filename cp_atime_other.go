@@ -0,0 +1,17 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+//go:build !(linux || openbsd || dragonfly || solaris || illumos || darwin || ios || freebsd || netbsd)
+
+package cmdutil
+
+import (
+	"os"
+	"time"
+)
+
+// fileAccessTime 当前平台无法读取访问时间，使用修改时间代替
+func fileAccessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
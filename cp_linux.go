@@ -0,0 +1,29 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+//go:build linux
+
+package cmdutil
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// ficlone ioctl FICLONE，在 btrfs、xfs 等文件系统上创建共享数据块的副本（reflink）
+var ficlone = func() uintptr {
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le", "ppc", "ppc64", "ppc64le", "sparc64":
+		return 0x80049409
+	default:
+		return 0x40049409
+	}
+}()
+
+// cloneFile 使用 FICLONE 创建共享数据块的副本，返回 false 时表示不支持（如 ext4、tmpfs 或者跨文件系统）
+func cloneFile(dst *os.File, src *os.File) bool {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	return errno == 0
+}
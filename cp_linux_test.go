@@ -0,0 +1,43 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/xanygo/anygo/xt"
+)
+
+func TestCopyFileData(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("hello world\n", 10000)
+	src := filepath.Join(dir, "src.txt")
+	writeTestFile(t, src, content)
+
+	rf, err := os.Open(src)
+	xt.NoError(t, err)
+	defer rf.Close()
+	wf, err := os.Create(filepath.Join(dir, "dst.txt"))
+	xt.NoError(t, err)
+	method, err := copyFileData(wf, rf, int64(len(content)))
+	xt.NoError(t, err)
+	xt.NoError(t, wf.Close())
+	xt.Equal(t, content, readTestFile(t, filepath.Join(dir, "dst.txt")))
+
+	var st syscall.Statfs_t
+	xt.NoError(t, syscall.Statfs(dir, &st))
+	const (
+		tmpfsMagic = 0x01021994
+		ext4Magic  = 0xEF53
+	)
+	if st.Type == tmpfsMagic || st.Type == ext4Magic {
+		// tmpfs 和 ext4 不支持 reflink
+		xt.Equal(t, cpByCopy, method)
+	}
+}
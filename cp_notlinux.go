@@ -0,0 +1,16 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+//go:build !linux
+
+package cmdutil
+
+import (
+	"os"
+)
+
+// cloneFile 当前平台不支持 reflink
+func cloneFile(dst *os.File, src *os.File) bool {
+	return false
+}
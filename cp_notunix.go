@@ -0,0 +1,19 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+//go:build !unix
+
+package cmdutil
+
+import (
+	"os"
+)
+
+func fileOwner(info os.FileInfo) (uid int, gid int, ok bool) {
+	return 0, 0, false
+}
+
+func isSymlinkLoopErr(err error) bool {
+	return false
+}
@@ -0,0 +1,190 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+// CompareMode 目标文件已存在时，判断文件是否有变化的方式
+type CompareMode int8
+
+const (
+	// CompareNone 不比较，总是复制，默认值
+	CompareNone CompareMode = iota
+
+	// CompareSizeModTime 文件大小和修改时间都相同时认为没有变化，不复制
+	// 一般需要同时设置 CP.PreserveTimes，否则目标文件的修改时间总是和源文件不同
+	CompareSizeModTime
+
+	// CompareChecksum 文件大小和内容的 sha256 都相同时认为没有变化，不复制
+	CompareChecksum
+)
+
+// CPResult CP.Sync 的结果，所有路径都是目标路径，并按照路径排序
+type CPResult struct {
+	// Added 新增的文件和目录
+	Added []string
+
+	// Updated 已存在并被覆盖更新的文件
+	Updated []string
+
+	// Removed 因为设置了 CP.Delete 而删除的文件和目录
+	// 对于删除的目录，只包含目录自身，不会展开其下的文件
+	Removed []string
+
+	// Actions 按照执行顺序的操作列表，只在 CP.DryRun 为 true 时才会记录
+	Actions []CPAction
+}
+
+// CPOp CP 的操作类型
+type CPOp string
+
+const (
+	CPOpMkdir     CPOp = "mkdir"     // 创建目录
+	CPOpCopy      CPOp = "copy"      // 复制到新文件
+	CPOpOverwrite CPOp = "overwrite" // 覆盖已存在的文件
+	CPOpSkip      CPOp = "skip"      // 因为过滤规则、回调或者文件没有变化而忽略
+	CPOpDelete    CPOp = "delete"    // 因为设置了 CP.Delete 而删除
+)
+
+func copyOp(exists bool) CPOp {
+	if exists {
+		return CPOpOverwrite
+	}
+	return CPOpCopy
+}
+
+// CPAction CP 的一个操作
+type CPAction struct {
+	Op CPOp
+
+	// Src 源路径，对于 delete 和创建 dst 上级目录时的 mkdir 为空
+	Src string
+
+	// Dst 目标路径
+	Dst string
+}
+
+func (a CPAction) String() string {
+	if len(a.Src) == 0 {
+		return string(a.Op) + " " + a.Dst
+	}
+	return string(a.Op) + " " + a.Src + " -> " + a.Dst
+}
+
+func (r *CPResult) sort() {
+	slices.Sort(r.Added)
+	slices.Sort(r.Updated)
+	slices.Sort(r.Removed)
+}
+
+// record 记录已经执行（DryRun 时为将要执行）的操作
+func (cj *cpJob) record(op CPOp, src string, dst string) {
+	cj.mu.Lock()
+	defer cj.mu.Unlock()
+	switch op {
+	case CPOpMkdir, CPOpCopy:
+		cj.result.Added = append(cj.result.Added, dst)
+	case CPOpOverwrite:
+		cj.result.Updated = append(cj.result.Updated, dst)
+	case CPOpDelete:
+		cj.result.Removed = append(cj.result.Removed, dst)
+	}
+	if cj.DryRun {
+		cj.result.Actions = append(cj.result.Actions, CPAction{Op: op, Src: src, Dst: dst})
+	}
+}
+
+// mkdirParent 创建 dst 的上级目录
+func (cj *cpJob) mkdirParent(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if !cj.DryRun {
+		if err := mkdir(dir); err != nil {
+			return err
+		}
+	}
+	cj.record(CPOpMkdir, "", dir)
+	return nil
+}
+
+// sameContent 按照 Compare 的配置判断源文件和已存在的目标文件是否相同
+func (cp *CP) sameContent(src string, dst string, info os.FileInfo, di os.FileInfo) (bool, error) {
+	if cp.Compare == CompareNone || !di.Mode().IsRegular() || info.Size() != di.Size() {
+		return false, nil
+	}
+	switch cp.Compare {
+	case CompareSizeModTime:
+		return info.ModTime().Equal(di.ModTime()), nil
+	case CompareChecksum:
+		h1, err := fileSHA256(src)
+		if err != nil {
+			return false, err
+		}
+		h2, err := fileSHA256(dst)
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(h1, h2), nil
+	default:
+		return false, nil
+	}
+}
+
+func fileSHA256(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// deleteExtra 删除目标目录 dst 中，在源目录中不存在的文件或者目录
+func (cj *cpJob) deleteExtra(dst string, rel string, srcEntries []os.DirEntry) error {
+	names := make(map[string]bool, len(srcEntries))
+	for _, entry := range srcEntries {
+		names[entry.Name()] = true
+	}
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if names[name] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if cj.checkIgnore(name, path.Join(rel, name), info) {
+			continue
+		}
+		fp := filepath.Join(dst, name)
+		if !cj.DryRun {
+			if err = os.RemoveAll(fp); err != nil {
+				return err
+			}
+		}
+		cj.record(CPOpDelete, "", fp)
+	}
+	return nil
+}
@@ -0,0 +1,508 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xanygo/anygo/xt"
+)
+
+func writeTestFile(t *testing.T, name string, content string) {
+	t.Helper()
+	xt.NoError(t, mkdir(filepath.Dir(name)))
+	xt.NoError(t, os.WriteFile(name, []byte(content), 0644))
+}
+
+func readTestFile(t *testing.T, name string) string {
+	t.Helper()
+	bf, err := os.ReadFile(name)
+	xt.NoError(t, err)
+	return string(bf)
+}
+
+func TestCP_Copy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b")
+
+	t.Run("file to new file", func(t *testing.T) {
+		cp := &CP{}
+		dst := filepath.Join(dir, "t1", "x", "a.txt")
+		xt.NoError(t, cp.Copy(dst, filepath.Join(src, "a.txt")))
+		xt.Equal(t, "a", readTestFile(t, dst))
+	})
+
+	t.Run("file to exists dir", func(t *testing.T) {
+		cp := &CP{}
+		dst := filepath.Join(dir, "t2")
+		xt.NoError(t, mkdir(dst))
+		xt.NoError(t, cp.Copy(dst, filepath.Join(src, "a.txt")))
+		xt.Equal(t, "a", readTestFile(t, filepath.Join(dst, "a.txt")))
+	})
+
+	t.Run("dir to new dir", func(t *testing.T) {
+		cp := &CP{}
+		dst := filepath.Join(dir, "t3")
+		xt.NoError(t, cp.Copy(dst, src))
+		xt.Equal(t, "a", readTestFile(t, filepath.Join(dst, "a.txt")))
+		xt.Equal(t, "b", readTestFile(t, filepath.Join(dst, "sub", "b.txt")))
+	})
+
+	t.Run("dir to exists dir", func(t *testing.T) {
+		cp := &CP{}
+		dst := filepath.Join(dir, "t4")
+		xt.NoError(t, mkdir(dst))
+		xt.NoError(t, cp.Copy(dst, src))
+		xt.Equal(t, "b", readTestFile(t, filepath.Join(dst, "src", "sub", "b.txt")))
+	})
+
+	t.Run("multi srcs", func(t *testing.T) {
+		cp := &CP{}
+		dst := filepath.Join(dir, "t5")
+		xt.Error(t, cp.Copy(dst, filepath.Join(src, "a.txt"), filepath.Join(src, "sub")))
+
+		xt.NoError(t, mkdir(dst))
+		xt.NoError(t, cp.Copy(dst, filepath.Join(src, "a.txt"), filepath.Join(src, "sub")))
+		xt.Equal(t, "a", readTestFile(t, filepath.Join(dst, "a.txt")))
+		xt.Equal(t, "b", readTestFile(t, filepath.Join(dst, "sub", "b.txt")))
+	})
+
+	t.Run("into itself", func(t *testing.T) {
+		cp := &CP{}
+		xt.Error(t, cp.Copy(filepath.Join(src, "sub", "x"), src))
+	})
+
+	t.Run("dir over file", func(t *testing.T) {
+		cp := &CP{}
+		dst := filepath.Join(dir, "t6")
+		writeTestFile(t, filepath.Join(dst, "sub"), "file")
+		xt.Error(t, cp.Copy(filepath.Join(dst, "sub"), filepath.Join(src, "sub")))
+	})
+
+	t.Run("not exists", func(t *testing.T) {
+		cp := &CP{}
+		xt.Error(t, cp.Copy(filepath.Join(dir, "t7"), filepath.Join(dir, "not-found")))
+	})
+}
+
+func TestCP_Preserve(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "bin", "run"), "run")
+	xt.NoError(t, os.Chmod(filepath.Join(src, "bin", "run"), 0750))
+	mt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	xt.NoError(t, os.Chtimes(filepath.Join(src, "bin", "run"), mt, mt))
+	xt.NoError(t, os.Chtimes(filepath.Join(src, "bin"), mt, mt))
+
+	cp := &CP{
+		PreserveMode:  true,
+		PreserveTimes: true,
+		PreserveOwner: true,
+	}
+	dst := filepath.Join(dir, "dst")
+	xt.NoError(t, cp.Copy(dst, src))
+
+	info, err := os.Stat(filepath.Join(dst, "bin", "run"))
+	xt.NoError(t, err)
+	xt.True(t, info.ModTime().Equal(mt))
+	if !isWindows() {
+		xt.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	}
+
+	info, err = os.Stat(filepath.Join(dst, "bin"))
+	xt.NoError(t, err)
+	xt.True(t, info.ModTime().Equal(mt))
+}
+
+func TestCP_Symlink(t *testing.T) {
+	if isWindows() {
+		t.Skip("symlink not supported")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "sub", "a.txt"), "a")
+	xt.NoError(t, os.Symlink("sub/a.txt", filepath.Join(src, "link.txt")))
+	xt.NoError(t, os.Symlink("sub", filepath.Join(src, "link_dir")))
+
+	t.Run("keep", func(t *testing.T) {
+		cp := &CP{}
+		dst := filepath.Join(dir, "keep")
+		xt.NoError(t, cp.Copy(dst, src))
+		target, err := os.Readlink(filepath.Join(dst, "link.txt"))
+		xt.NoError(t, err)
+		xt.Equal(t, "sub/a.txt", target)
+		target, err = os.Readlink(filepath.Join(dst, "link_dir"))
+		xt.NoError(t, err)
+		xt.Equal(t, "sub", target)
+	})
+
+	t.Run("follow", func(t *testing.T) {
+		cp := &CP{Symlink: SymlinkFollow}
+		dst := filepath.Join(dir, "follow")
+		xt.NoError(t, cp.Copy(dst, src))
+		info, err := os.Lstat(filepath.Join(dst, "link.txt"))
+		xt.NoError(t, err)
+		xt.True(t, info.Mode().IsRegular())
+		xt.Equal(t, "a", readTestFile(t, filepath.Join(dst, "link_dir", "a.txt")))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		cp := &CP{Symlink: SymlinkSkip}
+		dst := filepath.Join(dir, "skip")
+		xt.NoError(t, cp.Copy(dst, src))
+		_, err := os.Lstat(filepath.Join(dst, "link.txt"))
+		xt.True(t, os.IsNotExist(err))
+		xt.Equal(t, "a", readTestFile(t, filepath.Join(dst, "sub", "a.txt")))
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		src2 := filepath.Join(dir, "src2")
+		writeTestFile(t, filepath.Join(src2, "sub", "a.txt"), "a")
+		xt.NoError(t, os.Symlink("..", filepath.Join(src2, "sub", "parent")))
+		cp := &CP{Symlink: SymlinkFollow}
+		err := cp.Copy(filepath.Join(dir, "loop"), src2)
+		xt.True(t, errors.Is(err, ErrSymlinkLoop))
+
+		src3 := filepath.Join(dir, "src3")
+		xt.NoError(t, mkdir(src3))
+		xt.NoError(t, os.Symlink("self", filepath.Join(src3, "self")))
+		err = cp.Copy(filepath.Join(dir, "loop3"), src3)
+		xt.True(t, errors.Is(err, ErrSymlinkLoop))
+	})
+}
+
+func TestCP_Filter(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "a.go"), "package a")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "big.go"), "package big // big file")
+	writeTestFile(t, filepath.Join(src, "sub", "b.go"), "package b")
+	writeTestFile(t, filepath.Join(src, "testdata", "c.go"), "package c")
+
+	exists := func(name string) bool {
+		_, err := os.Stat(name)
+		return err == nil
+	}
+
+	t.Run("include exclude size", func(t *testing.T) {
+		cp := &CP{
+			Include: []string{"*.go"},
+			Exclude: []string{"testdata"},
+			MaxSize: 10,
+		}
+		dst := filepath.Join(dir, "t1")
+		xt.NoError(t, cp.Copy(dst, src))
+		xt.True(t, exists(filepath.Join(dst, "a.go")))
+		xt.True(t, exists(filepath.Join(dst, "sub", "b.go")))
+		xt.False(t, exists(filepath.Join(dst, "a.txt")))
+		xt.False(t, exists(filepath.Join(dst, "big.go")))
+		xt.False(t, exists(filepath.Join(dst, "testdata")))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		cp := &CP{Exclude: []string{"[a"}}
+		xt.Error(t, cp.Copy(filepath.Join(dir, "t2"), src))
+	})
+
+	t.Run("hooks", func(t *testing.T) {
+		var after []string
+		cp := &CP{
+			CopyNextBefore: func(src string, dst string, info os.FileInfo) (skip bool, err error) {
+				return info.Name() == "sub", nil
+			},
+			CopyNextAfter: func(src string, dst string, info os.FileInfo, err error) error {
+				after = append(after, info.Name())
+				return err
+			},
+		}
+		dst := filepath.Join(dir, "t3")
+		xt.NoError(t, cp.Copy(dst, src))
+		xt.False(t, exists(filepath.Join(dst, "sub")))
+		xt.Equal(t, []string{"a.go", "a.txt", "big.go", "c.go", "testdata", "src"}, after)
+	})
+
+	t.Run("before error", func(t *testing.T) {
+		errStop := errors.New("stop")
+		cp := &CP{
+			IgnoreFailed: true,
+			CopyNextBefore: func(src string, dst string, info os.FileInfo) (skip bool, err error) {
+				if info.Name() == "b.go" {
+					return false, errStop
+				}
+				return false, nil
+			},
+		}
+		err := cp.Copy(filepath.Join(dir, "t4"), src)
+		xt.True(t, errors.Is(err, errStop))
+	})
+
+	t.Run("ignore failed", func(t *testing.T) {
+		errFail := errors.New("fail")
+		cp := &CP{
+			IgnoreFailed: true,
+			CopyNextAfter: func(src string, dst string, info os.FileInfo, err error) error {
+				if info.Name() == "a.go" {
+					return errFail
+				}
+				return err
+			},
+		}
+		dst := filepath.Join(dir, "t5")
+		xt.NoError(t, cp.Copy(dst, src))
+		xt.True(t, exists(filepath.Join(dst, "sub", "b.go")))
+
+		cp.IgnoreFailed = false
+		xt.True(t, errors.Is(cp.Copy(filepath.Join(dir, "t6"), src), errFail))
+	})
+}
+
+func TestCP_Sync(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	// 使用 "src/." 的形式，同步 src 目录下的内容到 dst
+	srcContent := src + string(filepath.Separator) + "."
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b")
+
+	t.Run("size and mtime", func(t *testing.T) {
+		cp := &CP{
+			PreserveTimes: true,
+			Compare:       CompareSizeModTime,
+			Delete:        true,
+		}
+		ret, err := cp.Sync(dst, srcContent)
+		xt.NoError(t, err)
+		xt.Equal(t, []string{dst, filepath.Join(dst, "a.txt"), filepath.Join(dst, "sub"), filepath.Join(dst, "sub", "b.txt")}, ret.Added)
+		xt.Empty(t, ret.Updated)
+
+		ret, err = cp.Sync(dst, srcContent)
+		xt.NoError(t, err)
+		xt.Empty(t, ret.Added)
+		xt.Empty(t, ret.Updated)
+		xt.Empty(t, ret.Removed)
+
+		writeTestFile(t, filepath.Join(src, "a.txt"), "A")
+		mt := time.Now().Add(time.Hour)
+		xt.NoError(t, os.Chtimes(filepath.Join(src, "a.txt"), mt, mt))
+		writeTestFile(t, filepath.Join(dst, "extra", "c.txt"), "c")
+		writeTestFile(t, filepath.Join(dst, "sub", "d.txt"), "d")
+
+		ret, err = cp.Sync(dst, srcContent)
+		xt.NoError(t, err)
+		xt.Empty(t, ret.Added)
+		xt.Equal(t, []string{filepath.Join(dst, "a.txt")}, ret.Updated)
+		xt.Equal(t, []string{filepath.Join(dst, "extra"), filepath.Join(dst, "sub", "d.txt")}, ret.Removed)
+		xt.Equal(t, "A", readTestFile(t, filepath.Join(dst, "a.txt")))
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		cp := &CP{
+			Compare: CompareChecksum,
+		}
+		ret, err := cp.Sync(dst, srcContent)
+		xt.NoError(t, err)
+		xt.Empty(t, ret.Updated)
+
+		writeTestFile(t, filepath.Join(dst, "sub", "b.txt"), "x")
+		writeTestFile(t, filepath.Join(dst, "keep.txt"), "keep")
+		ret, err = cp.Sync(dst, srcContent)
+		xt.NoError(t, err)
+		xt.Equal(t, []string{filepath.Join(dst, "sub", "b.txt")}, ret.Updated)
+		xt.Empty(t, ret.Removed)
+		xt.Equal(t, "b", readTestFile(t, filepath.Join(dst, "sub", "b.txt")))
+	})
+
+	t.Run("delete with exclude", func(t *testing.T) {
+		cp := &CP{
+			Compare: CompareChecksum,
+			Delete:  true,
+			Exclude: []string{"*.log"},
+		}
+		writeTestFile(t, filepath.Join(dst, "run.log"), "log")
+		ret, err := cp.Sync(dst, srcContent)
+		xt.NoError(t, err)
+		xt.Equal(t, []string{filepath.Join(dst, "keep.txt")}, ret.Removed)
+		xt.Equal(t, "log", readTestFile(t, filepath.Join(dst, "run.log")))
+	})
+}
+
+func TestCP_Concurrency(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for i := 0; i < 20; i++ {
+		writeTestFile(t, filepath.Join(src, fmt.Sprintf("d%d", i%3), fmt.Sprintf("f%02d.txt", i)), fmt.Sprint(i))
+	}
+	mt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	xt.NoError(t, os.Chtimes(filepath.Join(src, "d1"), mt, mt))
+
+	t.Run("success", func(t *testing.T) {
+		cp := &CP{
+			Concurrency:   4,
+			PreserveTimes: true,
+		}
+		dst := filepath.Join(dir, "t1")
+		ret, err := cp.Sync(dst, src)
+		xt.NoError(t, err)
+		xt.Equal(t, 24, len(ret.Added))
+		xt.Equal(t, "7", readTestFile(t, filepath.Join(dst, "d1", "f07.txt")))
+
+		info, err := os.Stat(filepath.Join(dst, "d1"))
+		xt.NoError(t, err)
+		xt.True(t, info.ModTime().Equal(mt))
+	})
+
+	t.Run("first error", func(t *testing.T) {
+		cp := &CP{
+			Concurrency: 4,
+			CopyNextAfter: func(src string, dst string, info os.FileInfo, err error) error {
+				if strings.HasPrefix(info.Name(), "f1") {
+					return errors.New("failed " + info.Name())
+				}
+				return err
+			},
+		}
+		for i := 0; i < 5; i++ {
+			err := cp.Copy(filepath.Join(dir, fmt.Sprintf("t2_%d", i)), src)
+			xt.Error(t, err)
+			xt.Equal(t, "failed f12.txt", err.Error())
+		}
+	})
+
+	t.Run("dir after files", func(t *testing.T) {
+		// 对于目录，CopyNextAfter 在目录下所有文件都处理完成后才回调
+		done := map[string]int{}
+		var dirs []string
+		var stopped bool
+		hook := func(src string, dst string, info os.FileInfo, err error) error {
+			if errors.Is(err, errCPStopped) {
+				stopped = true
+			}
+			if !info.IsDir() {
+				done[filepath.Dir(src)]++
+				return err
+			}
+			dirs = append(dirs, info.Name())
+			entries, err1 := os.ReadDir(src)
+			xt.NoError(t, err1)
+			var files int
+			for _, e := range entries {
+				if !e.IsDir() {
+					files++
+				}
+			}
+			xt.Equal(t, files, done[src])
+			return err
+		}
+		cp := &CP{Concurrency: 4, CopyNextAfter: hook}
+		xt.NoError(t, cp.Copy(filepath.Join(dir, "t3"), src))
+		xt.Equal(t, []string{"d0", "d1", "d2", "src"}, dirs)
+
+		clear(done)
+		cp.CopyNextAfter = func(src string, dst string, info os.FileInfo, err error) error {
+			err = hook(src, dst, info, err)
+			if info.Name() == "f04.txt" {
+				return errors.New("failed f04.txt")
+			}
+			return err
+		}
+		xt.Error(t, cp.Copy(filepath.Join(dir, "t4"), src))
+		xt.False(t, stopped)
+	})
+}
+
+func TestCP_Atomic(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "dst", "a.txt"), "old")
+	xt.NoError(t, os.Chmod(filepath.Join(dir, "dst", "a.txt"), 0600))
+
+	listDst := func() []string {
+		entries, err := os.ReadDir(filepath.Join(dir, "dst"))
+		xt.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	t.Run("success", func(t *testing.T) {
+		cp := &CP{Atomic: true}
+		xt.NoError(t, cp.Copy(filepath.Join(dir, "dst"), filepath.Join(src, "a.txt")))
+		xt.Equal(t, "a", readTestFile(t, filepath.Join(dir, "dst", "a.txt")))
+		xt.Equal(t, []string{"a.txt"}, listDst())
+		if !isWindows() {
+			info, err := os.Stat(filepath.Join(dir, "dst", "a.txt"))
+			xt.NoError(t, err)
+			xt.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		info, err := os.Stat(filepath.Join(src, "a.txt"))
+		xt.NoError(t, err)
+		// 读取目录会失败
+		rf, err := os.Open(src)
+		xt.NoError(t, err)
+		defer rf.Close()
+
+		cj := newCPJob(&CP{Atomic: true})
+		err = cj.copyRegularAtomic(rf, filepath.Join(dir, "dst", "b.txt"), info, nil)
+		xt.Error(t, err)
+		xt.Equal(t, []string{"a.txt"}, listDst())
+	})
+}
+
+func TestCP_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "b.txt"), "b")
+	writeTestFile(t, filepath.Join(src, "c.log"), "c")
+	writeTestFile(t, filepath.Join(src, "sub", "d.txt"), "d")
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dst, "b.txt"), "old")
+	writeTestFile(t, filepath.Join(dst, "old.txt"), "old")
+
+	cp := &CP{
+		DryRun:  true,
+		Compare: CompareChecksum,
+		Delete:  true,
+		Exclude: []string{"*.log"},
+	}
+	ret, err := cp.Sync(dst, src+string(filepath.Separator)+".")
+	xt.NoError(t, err)
+	want := []CPAction{
+		{Op: CPOpDelete, Dst: filepath.Join(dst, "old.txt")},
+		{Op: CPOpSkip, Src: filepath.Join(src, "a.txt"), Dst: filepath.Join(dst, "a.txt")},
+		{Op: CPOpOverwrite, Src: filepath.Join(src, "b.txt"), Dst: filepath.Join(dst, "b.txt")},
+		{Op: CPOpSkip, Src: filepath.Join(src, "c.log"), Dst: filepath.Join(dst, "c.log")},
+		{Op: CPOpMkdir, Src: filepath.Join(src, "sub"), Dst: filepath.Join(dst, "sub")},
+		{Op: CPOpCopy, Src: filepath.Join(src, "sub", "d.txt"), Dst: filepath.Join(dst, "sub", "d.txt")},
+	}
+	xt.Equal(t, want, ret.Actions)
+	xt.Equal(t, []string{filepath.Join(dst, "sub"), filepath.Join(dst, "sub", "d.txt")}, ret.Added)
+	xt.Equal(t, []string{filepath.Join(dst, "b.txt")}, ret.Updated)
+	xt.Equal(t, []string{filepath.Join(dst, "old.txt")}, ret.Removed)
+	xt.Equal(t, "delete "+filepath.Join(dst, "old.txt"), ret.Actions[0].String())
+
+	// 文件系统没有变化
+	xt.Equal(t, "old", readTestFile(t, filepath.Join(dst, "b.txt")))
+	xt.Equal(t, "old", readTestFile(t, filepath.Join(dst, "old.txt")))
+	_, err = os.Stat(filepath.Join(dst, "sub"))
+	xt.True(t, os.IsNotExist(err))
+}
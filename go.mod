@@ -3,6 +3,8 @@ module github.com/fsgo/cmdutil
 go 1.25.1
 
 require (
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.15
 	github.com/xanygo/anygo v0.0.0-20251029042508-4d7e4b6ea62b
 	golang.org/x/mod v0.29.0
 )
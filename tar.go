@@ -7,15 +7,15 @@ package cmdutil
 import (
 	"archive/tar"
 	"bufio"
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
-// Tar tape archive 工具，目前已经具备压缩文件
+// Tar tape archive 工具，支持打包和解包
 type Tar struct {
 	// UnpackNextBefore 在 Unpack 时，解析到下一个 Header 后，实际 unpack 前的回调
 	UnpackNextBefore func(h *tar.Header) (skip bool, err error)
@@ -23,32 +23,57 @@ type Tar struct {
 	// UnpackNextAfter 在 Unpack 时，解析到下一个 Header 后，实际 unpack 后的回调
 	UnpackNextAfter func(h *tar.Header, err error) error
 
+	// PackNextBefore 在 Pack 时，生成下一个文件的 Header 后，实际写入前的回调
+	// 可以修改 h 的内容，若 skip=true，则忽略该文件，若是目录，则整个目录都会被忽略
+	PackNextBefore func(h *tar.Header) (skip bool, err error)
+
+	// PackNextAfter 在 Pack 时，生成下一个文件的 Header 后，实际写入后的回调
+	PackNextAfter func(h *tar.Header, err error) error
+
 	// UnCompress Unpack 时的解压缩方法，可选
+	// 默认为按照数据开头的 magic bytes 自动识别，和文件后缀无关：
+	// 支持 gzip、bzip2、xz、zstd，都不是时认为是未压缩的 tar 包
+	UnCompress func(rd io.Reader) (io.Reader, error)
+
+	// Compress Pack 时的压缩方法，可选
 	// 默认为按照文件后缀自动选择：
 	// 1.后缀为 .gz 和 .tgz 时选择 gzip
-	UnCompress func(rd io.Reader) (io.Reader, error)
+	Compress func(w io.Writer) (io.WriteCloser, error)
 
 	// StripComponents Unpack 的时候，忽略掉前 N 层目录
+	// Pack 的时候，忽略掉文件在 tar 包中的路径的前 N 层目录
 	StripComponents uint
 
+	// PackPrefix Pack 的时候，在文件在 tar 包中的路径前添加的目录，可选
+	// 在 StripComponents 之后处理
+	PackPrefix string
+
+	// Reproducible Pack 的时候，是否生成可重现的 tar 包，可选
+	// 为 true 时，相同内容的目录总是生成完全相同的 tar 包：
+	// 1.文件按照路径排序（每个 src 内部）
+	// 2.uid、gid 设置为 0，uname、gname 设置为空
+	// 3.修改时间截断到秒，并且不晚于 SourceDateEpoch，不写入访问时间和变更时间
+	// 4.总是使用 PAX 格式
+	Reproducible bool
+
+	// SourceDateEpoch Reproducible 时文件修改时间的最大值，可选
+	// 为零值时，读取环境变量 SOURCE_DATE_EPOCH（Unix 时间戳，单位秒），若也没有则不限制
+	SourceDateEpoch time.Time
+
 	// MinSize 最小文件大小，>0 时有效
 	MinSize int64
 
 	// MaxSize 最小文件大小，>0 时有效
 	MaxSize int64
 
+	// Limit Unpack 时的限制，用于防止压缩炸弹，可选
+	Limit UnpackLimit
+
 	// IgnoreFailed 是否忽略异常
-	// 不会忽略 UnpackNextBefore 返回的 error
+	// 不会忽略 UnpackNextBefore、PackNextBefore 返回的 error，以及超出 Limit 的 error
 	IgnoreFailed bool
 }
 
-func (tr *Tar) validRelPath(p string) bool {
-	if len(p) == 0 || strings.Contains(p, `\`) || strings.HasPrefix(p, "/") || strings.Contains(p, "../") {
-		return false
-	}
-	return true
-}
-
 func (tr *Tar) unpackTo(p string) string {
 	if tr.StripComponents == 0 {
 		return p
@@ -62,27 +87,35 @@ func (tr *Tar) unpackTo(p string) string {
 	return filepath.Join(ps[sc:]...)
 }
 
-func (tr *Tar) unCompress(rd io.Reader, name string) (io.Reader, error) {
+func (tr *Tar) unCompress(rd io.Reader) (io.Reader, error) {
 	if tr.UnCompress != nil {
 		return tr.UnCompress(rd)
 	}
-
-	if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") {
-		return gzip.NewReader(rd)
-	}
-
-	return rd, nil
+	return unCompressByMagic(rd)
 }
 
 // Unpack 解压缩文件到指定目录
 func (tr *Tar) Unpack(archiveFile string, targetDir string) error {
+	var err error
+	err0 := tr.open(archiveFile, func(trd *tar.Reader, cr *countReader) {
+		err = tr.unpackFromReader(trd, targetDir, cr)
+	})
+	if err0 != nil {
+		return err0
+	}
+	return err
+}
+
+// open 打开并解压缩 archiveFile 后调用 fn，cr 记录了读取的压缩数据的大小
+func (tr *Tar) open(archiveFile string, fn func(trd *tar.Reader, cr *countReader)) error {
 	tf, err0 := os.Open(archiveFile)
 	if err0 != nil {
 		return err0
 	}
 	defer tf.Close()
 
-	zr, err1 := tr.unCompress(tf, filepath.Base(archiveFile))
+	cr := &countReader{rd: tf}
+	zr, err1 := tr.unCompress(cr)
 	if err1 != nil {
 		return err1
 	}
@@ -90,13 +123,19 @@ func (tr *Tar) Unpack(archiveFile string, targetDir string) error {
 	if rc, ok := zr.(io.Closer); ok {
 		defer rc.Close()
 	}
-	trd := tar.NewReader(zr)
-	return tr.UnpackFromReader(trd, targetDir)
+	fn(tar.NewReader(zr), cr)
+	return nil
 }
 
 // UnpackFromReader 从 tar.Reader 解压数据
 func (tr *Tar) UnpackFromReader(trd *tar.Reader, targetDir string) error {
+	return tr.unpackFromReader(trd, targetDir, nil)
+}
+
+// unpackFromReader cr 用于统计读取的压缩数据的大小，以检查压缩比，可以为 nil
+func (tr *Tar) unpackFromReader(trd *tar.Reader, targetDir string, cr *countReader) error {
 	madeDir := map[string]bool{}
+	ul := &unpackLimiter{limit: tr.Limit, stream: cr}
 
 	for {
 		th, err2 := trd.Next()
@@ -107,8 +146,11 @@ func (tr *Tar) UnpackFromReader(trd *tar.Reader, targetDir string) error {
 			return err2
 		}
 
-		if !tr.validRelPath(th.Name) {
-			return fmt.Errorf("tar file contained invalid name %q", th.Name)
+		if err := checkEntryName(th.Name); err != nil {
+			return err
+		}
+		if err := ul.checkEntry(th.Name, filepath.ToSlash(tr.unpackTo(th.Name))); err != nil {
+			return err
 		}
 
 		if tr.UnpackNextBefore != nil {
@@ -119,13 +161,13 @@ func (tr *Tar) UnpackFromReader(trd *tar.Reader, targetDir string) error {
 			}
 		}
 
-		err3 := tr.unpackOne(trd, th, targetDir, madeDir)
+		err3 := tr.unpackOne(trd, th, targetDir, madeDir, ul)
 
 		if tr.UnpackNextAfter != nil {
 			err3 = tr.UnpackNextAfter(th, err3)
 		}
 
-		if err3 != nil && !tr.IgnoreFailed {
+		if err3 != nil && (!tr.IgnoreFailed || isLimitError(err3)) {
 			return err3
 		}
 	}
@@ -145,7 +187,7 @@ func (tr *Tar) checkMinMaxIgnore(th *tar.Header) bool {
 	return false
 }
 
-func (tr *Tar) unpackOne(trd *tar.Reader, th *tar.Header, targetDir string, madeDir map[string]bool) error {
+func (tr *Tar) unpackOne(trd *tar.Reader, th *tar.Header, targetDir string, madeDir map[string]bool, ul *unpackLimiter) error {
 	to := tr.unpackTo(th.Name)
 	if len(to) == 0 {
 		return nil
@@ -155,11 +197,18 @@ func (tr *Tar) unpackOne(trd *tar.Reader, th *tar.Header, targetDir string, made
 		return nil
 	}
 
-	abs := filepath.Join(targetDir, to)
+	abs, err := securePath(targetDir, filepath.ToSlash(to), th.Name)
+	if err != nil {
+		return err
+	}
 	fi := th.FileInfo()
 
 	mode := fi.Mode()
 	switch {
+	case th.Typeflag == tar.TypeLink:
+		return tr.unpackHardlink(th, abs, targetDir, madeDir)
+	case mode&os.ModeSymlink != 0:
+		return tr.unpackSymlink(th, abs, targetDir, madeDir)
 	case mode.IsRegular():
 		// Make the directory. This is redundant because it should
 		// already be made by a directory entry in the tar
@@ -178,7 +227,7 @@ func (tr *Tar) unpackOne(trd *tar.Reader, th *tar.Header, targetDir string, made
 		}
 		defer wf.Close()
 
-		if err = copyFile(trd, wf, th.Size); err != nil {
+		if err = copyFile(ul.reader(th.Name, trd, nil), wf, th.Size); err != nil {
 			return fmt.Errorf("error writing to %s: %w", abs, err)
 		}
 		if !th.ModTime.IsZero() {
@@ -197,6 +246,69 @@ func (tr *Tar) unpackOne(trd *tar.Reader, th *tar.Header, targetDir string, made
 	return nil
 }
 
+func (tr *Tar) mkdirParent(abs string, madeDir map[string]bool) error {
+	dir := filepath.Dir(abs)
+	if madeDir[dir] {
+		return nil
+	}
+	if err := mkdir(dir); err != nil {
+		return err
+	}
+	madeDir[dir] = true
+	return nil
+}
+
+// removeExists 删除已存在的非目录文件，以便创建链接
+func removeExists(abs string) error {
+	info, err := os.Lstat(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot overwrite directory %q with link", abs)
+	}
+	return os.Remove(abs)
+}
+
+// unpackSymlink 创建符号链接，链接的目标必须在 targetDir 内
+func (tr *Tar) unpackSymlink(th *tar.Header, abs string, targetDir string, madeDir map[string]bool) error {
+	if err := checkLinkTarget(targetDir, abs, th.Linkname, th.Name); err != nil {
+		return err
+	}
+	if err := tr.mkdirParent(abs, madeDir); err != nil {
+		return err
+	}
+	if err := removeExists(abs); err != nil {
+		return err
+	}
+	return os.Symlink(th.Linkname, abs)
+}
+
+// unpackHardlink 创建硬链接，链接的目标是 tar 包中之前已经解压了的文件
+func (tr *Tar) unpackHardlink(th *tar.Header, abs string, targetDir string, madeDir map[string]bool) error {
+	if err := checkEntryName(th.Linkname); err != nil {
+		return &UnsafePathError{Name: th.Name, Path: th.Linkname}
+	}
+	to := tr.unpackTo(th.Linkname)
+	if len(to) == 0 {
+		return fmt.Errorf("tar file entry %s contained hardlink target %q which is stripped", th.Name, th.Linkname)
+	}
+	dest, err := securePath(targetDir, filepath.ToSlash(to), th.Name)
+	if err != nil {
+		return &UnsafePathError{Name: th.Name, Path: th.Linkname}
+	}
+	if err := tr.mkdirParent(abs, madeDir); err != nil {
+		return err
+	}
+	if err := removeExists(abs); err != nil {
+		return err
+	}
+	return os.Link(dest, abs)
+}
+
 func copyFile(from io.Reader, to io.Writer, want int64) error {
 	bw := bufio.NewWriter(to)
 	read, err := bw.ReadFrom(from)
@@ -208,3 +320,68 @@ func copyFile(from io.Reader, to io.Writer, want int64) error {
 	}
 	return bw.Flush()
 }
+
+// List 返回压缩包中会被解压的文件的信息，不会解压
+//
+// 和 Unpack 一样，会按照 StripComponents、MinSize、MaxSize、Limit 和 UnpackNextBefore 过滤
+func (tr *Tar) List(archiveFile string) ([]ArchiveEntry, error) {
+	var list []ArchiveEntry
+	var err error
+	err0 := tr.open(archiveFile, func(trd *tar.Reader, _ *countReader) {
+		list, err = tr.ListFromReader(trd)
+	})
+	if err0 != nil {
+		return nil, err0
+	}
+	return list, err
+}
+
+// ListFromReader 返回 tar.Reader 中会被解压的文件的信息
+func (tr *Tar) ListFromReader(trd *tar.Reader) ([]ArchiveEntry, error) {
+	ul := &unpackLimiter{limit: tr.Limit}
+	var list []ArchiveEntry
+	for {
+		th, err2 := trd.Next()
+		if err2 == io.EOF {
+			break
+		}
+		if err2 != nil {
+			return nil, err2
+		}
+
+		if err := checkEntryName(th.Name); err != nil {
+			return nil, err
+		}
+		to := filepath.ToSlash(tr.unpackTo(th.Name))
+		if err := ul.checkEntry(th.Name, to); err != nil {
+			return nil, err
+		}
+
+		if tr.UnpackNextBefore != nil {
+			if skip, err4 := tr.UnpackNextBefore(th); skip {
+				continue
+			} else if err4 != nil {
+				return nil, err4
+			}
+		}
+		if len(to) == 0 || tr.checkMinMaxIgnore(th) {
+			continue
+		}
+
+		mode := th.FileInfo().Mode()
+		entry := ArchiveEntry{
+			Name:     th.Name,
+			Path:     to,
+			Type:     entryType(mode),
+			Size:     th.Size,
+			Mode:     mode,
+			ModTime:  th.ModTime,
+			Linkname: th.Linkname,
+		}
+		if th.Typeflag == tar.TypeLink {
+			entry.Type = EntryHardlink
+		}
+		list = append(list, entry)
+	}
+	return list, nil
+}
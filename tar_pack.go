@@ -0,0 +1,263 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (tr *Tar) packTo(name string) string {
+	name = strings.TrimSuffix(name, "/")
+	if tr.StripComponents > 0 {
+		sc := int(tr.StripComponents)
+		ps := strings.Split(name, "/")
+		if len(ps) <= sc {
+			return ""
+		}
+		name = strings.Join(ps[sc:], "/")
+	}
+	if len(tr.PackPrefix) > 0 {
+		name = path.Join(tr.PackPrefix, name)
+	}
+	return name
+}
+
+func (tr *Tar) compress(w io.Writer, name string) (io.WriteCloser, error) {
+	if tr.Compress != nil {
+		return tr.Compress(w)
+	}
+
+	if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") {
+		return gzip.NewWriter(w), nil
+	}
+
+	return nopWriteCloser{Writer: w}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Pack 将文件或者目录打包为 archiveFile
+//
+// 每个 src 在 tar 包中的路径为 {src 的文件名}/{相对于 src 的路径}，
+// 可以使用 StripComponents 和 PackPrefix 调整
+func (tr *Tar) Pack(archiveFile string, srcs ...string) (err error) {
+	if err = mkdir(filepath.Dir(archiveFile)); err != nil {
+		return err
+	}
+	tf, err := os.Create(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tf.Close()
+			os.Remove(archiveFile)
+		}
+	}()
+
+	self, err := tf.Stat()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(tf)
+	zw, err := tr.compress(bw, filepath.Base(archiveFile))
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+	if err = tr.packToWriter(tw, self, srcs); err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	return tf.Close()
+}
+
+// PackToWriter 将文件或者目录打包写入 tar.Writer，不会调用 tw.Close
+func (tr *Tar) PackToWriter(tw *tar.Writer, srcs ...string) error {
+	return tr.packToWriter(tw, nil, srcs)
+}
+
+// packToWriter self 是正在写入的 tar 文件自身，打包时会跳过，可以为 nil
+func (tr *Tar) packToWriter(tw *tar.Writer, self os.FileInfo, srcs []string) error {
+	if len(srcs) == 0 {
+		return errors.New("missing source path")
+	}
+	var epoch time.Time
+	if tr.Reproducible {
+		var err error
+		if epoch, err = tr.sourceDateEpoch(); err != nil {
+			return err
+		}
+	}
+	for _, src := range srcs {
+		if err := tr.packOne(tw, self, src, epoch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tr *Tar) packOne(tw *tar.Writer, self os.FileInfo, src string, epoch time.Time) error {
+	base := filepath.Base(src)
+	return filepath.WalkDir(src, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if tr.IgnoreFailed && fp != src {
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			if tr.IgnoreFailed {
+				return nil
+			}
+			return err
+		}
+		if self != nil && os.SameFile(self, info) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, fp)
+		if err != nil {
+			return err
+		}
+		th, err := tr.packHeader(fp, path.Join(base, filepath.ToSlash(rel)), info, epoch)
+		if err != nil {
+			if tr.IgnoreFailed {
+				return nil
+			}
+			return err
+		}
+		if th == nil || tr.checkMinMaxIgnore(th) {
+			return nil
+		}
+
+		if tr.PackNextBefore != nil {
+			if skip, err4 := tr.PackNextBefore(th); skip {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			} else if err4 != nil {
+				return err4
+			}
+		}
+
+		err3 := tr.packEntry(tw, fp, th)
+
+		if tr.PackNextAfter != nil {
+			err3 = tr.PackNextAfter(th, err3)
+		}
+
+		if err3 != nil && !tr.IgnoreFailed {
+			return err3
+		}
+		return nil
+	})
+}
+
+// packHeader 生成文件在 tar 中的 Header，若返回 nil 表示需要忽略
+func (tr *Tar) packHeader(fp string, name string, info os.FileInfo, epoch time.Time) (*tar.Header, error) {
+	to := tr.packTo(name)
+	if len(to) == 0 {
+		return nil, nil
+	}
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(fp); err != nil {
+			return nil, err
+		}
+	}
+	th, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	th.Name = to
+	if info.IsDir() {
+		th.Name += "/"
+	}
+	if tr.Reproducible {
+		normalizeHeader(th, epoch)
+	}
+	return th, nil
+}
+
+func (tr *Tar) sourceDateEpoch() (time.Time, error) {
+	if !tr.SourceDateEpoch.IsZero() {
+		return tr.SourceDateEpoch, nil
+	}
+	str := os.Getenv("SOURCE_DATE_EPOCH")
+	if len(str) == 0 {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", str, err)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// normalizeHeader 去掉 Header 中和构建环境相关的信息，epoch 非零值时，修改时间不会晚于 epoch
+func normalizeHeader(th *tar.Header, epoch time.Time) {
+	th.Uid = 0
+	th.Gid = 0
+	th.Uname = ""
+	th.Gname = ""
+	th.AccessTime = time.Time{}
+	th.ChangeTime = time.Time{}
+	th.ModTime = th.ModTime.Truncate(time.Second)
+	if !epoch.IsZero() && th.ModTime.After(epoch) {
+		th.ModTime = epoch.Truncate(time.Second)
+	}
+	th.PAXRecords = nil
+	th.Format = tar.FormatPAX
+}
+
+func (tr *Tar) packEntry(tw *tar.Writer, fp string, th *tar.Header) error {
+	if th.Typeflag != tar.TypeReg || th.Size == 0 {
+		return tw.WriteHeader(th)
+	}
+	// 先打开文件再写 Header，以避免打开失败时 tar 中只有 Header 而没有内容
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = tw.WriteHeader(th); err != nil {
+		return err
+	}
+	if _, err = io.CopyN(tw, f, th.Size); err != nil {
+		return fmt.Errorf("error reading from %s: %w", fp, err)
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/xanygo/anygo/xt"
+)
+
+func TestTar_Pack(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b")
+	writeTestFile(t, filepath.Join(src, "empty.txt"), "")
+
+	t.Run("pack and unpack", func(t *testing.T) {
+		var names []string
+		tr := &Tar{
+			MinSize: 1,
+			PackNextBefore: func(h *tar.Header) (skip bool, err error) {
+				names = append(names, h.Name)
+				return false, nil
+			},
+		}
+		archive := filepath.Join(dir, "out", "a.tar.gz")
+		xt.NoError(t, tr.Pack(archive, src))
+		xt.Equal(t, []string{"src/", "src/a.txt", "src/sub/", "src/sub/b.txt"}, names)
+
+		tr2 := &Tar{}
+		xt.NoError(t, tr2.Unpack(archive, filepath.Join(dir, "t1")))
+		xt.Equal(t, "a", readTestFile(t, filepath.Join(dir, "t1", "src", "a.txt")))
+		xt.Equal(t, "b", readTestFile(t, filepath.Join(dir, "t1", "src", "sub", "b.txt")))
+	})
+
+	t.Run("strip and prefix", func(t *testing.T) {
+		var names []string
+		tr := &Tar{
+			StripComponents: 1,
+			PackPrefix:      "go",
+			PackNextBefore: func(h *tar.Header) (skip bool, err error) {
+				return h.Name == "go/sub/", nil
+			},
+			PackNextAfter: func(h *tar.Header, err error) error {
+				names = append(names, h.Name)
+				return err
+			},
+		}
+		archive := filepath.Join(dir, "out", "b.tar")
+		xt.NoError(t, tr.Pack(archive, src))
+		xt.Equal(t, []string{"go/a.txt", "go/empty.txt"}, names)
+	})
+
+	t.Run("archive in src", func(t *testing.T) {
+		tr := &Tar{}
+		archive := filepath.Join(src, "self.tgz")
+		xt.NoError(t, tr.Pack(archive, src))
+
+		var names []string
+		tr2 := &Tar{
+			UnpackNextBefore: func(h *tar.Header) (skip bool, err error) {
+				names = append(names, h.Name)
+				return true, nil
+			},
+		}
+		xt.NoError(t, tr2.Unpack(archive, filepath.Join(dir, "t3")))
+		xt.Equal(t, []string{"src/", "src/a.txt", "src/empty.txt", "src/sub/", "src/sub/b.txt"}, names)
+	})
+}
+
+func TestTar_Reproducible(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b")
+
+	epoch := time.Date(2022, 1, 16, 0, 0, 0, 0, time.UTC)
+	tr := &Tar{
+		Reproducible:    true,
+		SourceDateEpoch: epoch,
+	}
+	a1 := filepath.Join(dir, "a1.tar.gz")
+	xt.NoError(t, tr.Pack(a1, src))
+
+	// 修改时间变化后，生成的 tar 包依然相同
+	mt := time.Now().Add(time.Hour)
+	xt.NoError(t, os.Chtimes(filepath.Join(src, "a.txt"), mt, mt))
+	xt.NoError(t, os.Chtimes(filepath.Join(src, "sub"), mt, mt))
+	a2 := filepath.Join(dir, "a2.tar.gz")
+	xt.NoError(t, tr.Pack(a2, src))
+	xt.Equal(t, readTestFile(t, a1), readTestFile(t, a2))
+
+	tr2 := &Tar{
+		UnpackNextBefore: func(h *tar.Header) (skip bool, err error) {
+			xt.Equal(t, 0, h.Uid)
+			xt.Equal(t, "", h.Uname)
+			xt.True(t, h.ModTime.Equal(epoch))
+			return true, nil
+		},
+	}
+	xt.NoError(t, tr2.Unpack(a2, filepath.Join(dir, "t1")))
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("SOURCE_DATE_EPOCH", "abc")
+		tr := &Tar{Reproducible: true, IgnoreFailed: true}
+		xt.Error(t, tr.Pack(filepath.Join(dir, "a3.tar"), src))
+	})
+}
+
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	link     string
+	body     string
+}
+
+func newTestTarReader(t *testing.T, entries []testTarEntry) *tar.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		h := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.link,
+			Size:     int64(len(e.body)),
+			Mode:     0644,
+		}
+		if e.typeflag == tar.TypeDir {
+			h.Mode = 0755
+		}
+		xt.NoError(t, tw.WriteHeader(h))
+		_, err := tw.Write([]byte(e.body))
+		xt.NoError(t, err)
+	}
+	xt.NoError(t, tw.Close())
+	return tar.NewReader(&buf)
+}
+
+func TestTar_UnpackLinks(t *testing.T) {
+	if isWindows() {
+		t.Skip("symlink not supported")
+	}
+	dir := t.TempDir()
+
+	t.Run("success", func(t *testing.T) {
+		trd := newTestTarReader(t, []testTarEntry{
+			{name: "go/", typeflag: tar.TypeDir},
+			{name: "go/bin/go", typeflag: tar.TypeReg, body: "go"},
+			{name: "go/bin/go2", typeflag: tar.TypeLink, link: "go/bin/go"},
+			{name: "go/lib/go", typeflag: tar.TypeSymlink, link: "../bin/go"},
+		})
+		tr := &Tar{StripComponents: 1}
+		out := filepath.Join(dir, "t1")
+		xt.NoError(t, tr.UnpackFromReader(trd, out))
+		xt.Equal(t, "go", readTestFile(t, filepath.Join(out, "bin", "go2")))
+		xt.Equal(t, "go", readTestFile(t, filepath.Join(out, "lib", "go")))
+		target, err := os.Readlink(filepath.Join(out, "lib", "go"))
+		xt.NoError(t, err)
+		xt.Equal(t, "../bin/go", target)
+	})
+
+	t.Run("escape", func(t *testing.T) {
+		cases := []testTarEntry{
+			{name: "a", typeflag: tar.TypeSymlink, link: "../outside"},
+			{name: "a", typeflag: tar.TypeSymlink, link: "/etc/passwd"},
+			{name: "b/a", typeflag: tar.TypeSymlink, link: "../../outside"},
+			{name: "a", typeflag: tar.TypeLink, link: "../outside"},
+		}
+		for _, c := range cases {
+			tr := &Tar{}
+			err := tr.UnpackFromReader(newTestTarReader(t, []testTarEntry{c}), filepath.Join(dir, "t2"))
+			xt.Error(t, err)
+		}
+	})
+}
+
+func TestTar_UnpackUnsafePath(t *testing.T) {
+	if isWindows() {
+		t.Skip("symlink not supported")
+	}
+	dir := t.TempDir()
+	cases := [][]testTarEntry{
+		{{name: "..", typeflag: tar.TypeDir}},
+		{{name: "foo/..", typeflag: tar.TypeDir}},
+		{{name: "../x", typeflag: tar.TypeReg, body: "x"}},
+		{
+			{name: "link", typeflag: tar.TypeSymlink, link: "."},
+			{name: "link/../../x", typeflag: tar.TypeReg, body: "x"},
+		},
+		{
+			// 链接的目标在 targetDir 内，但是经过另外一个链接后在 targetDir 之外
+			{name: "up", typeflag: tar.TypeSymlink, link: "sub/.."},
+			{name: "sub/", typeflag: tar.TypeDir},
+			{name: "sub/up2", typeflag: tar.TypeSymlink, link: "../up/.."},
+		},
+	}
+	for _, entries := range cases {
+		tr := &Tar{}
+		err := tr.UnpackFromReader(newTestTarReader(t, entries), filepath.Join(dir, "out"))
+		var ue *UnsafePathError
+		xt.True(t, errors.As(err, &ue))
+	}
+}
+
+func TestTar_UnpackLimit(t *testing.T) {
+	entries := []testTarEntry{
+		{name: "a/", typeflag: tar.TypeDir},
+		{name: "a/b/c.txt", typeflag: tar.TypeReg, body: "hello"},
+		{name: "d.txt", typeflag: tar.TypeReg, body: "world"},
+	}
+	checkLimit := func(t *testing.T, limit UnpackLimit, want string) {
+		tr := &Tar{Limit: limit, IgnoreFailed: true}
+		err := tr.UnpackFromReader(newTestTarReader(t, entries), t.TempDir())
+		var le *LimitError
+		xt.True(t, errors.As(err, &le))
+		xt.Equal(t, want, le.Limit)
+	}
+	t.Run("entries", func(t *testing.T) {
+		checkLimit(t, UnpackLimit{MaxEntries: 2}, "MaxEntries")
+	})
+	t.Run("depth", func(t *testing.T) {
+		checkLimit(t, UnpackLimit{MaxDepth: 2}, "MaxDepth")
+	})
+	t.Run("total", func(t *testing.T) {
+		checkLimit(t, UnpackLimit{MaxTotalSize: 8}, "MaxTotalSize")
+	})
+	t.Run("ok", func(t *testing.T) {
+		tr := &Tar{Limit: UnpackLimit{MaxEntries: 3, MaxDepth: 3, MaxTotalSize: 10}}
+		xt.NoError(t, tr.UnpackFromReader(newTestTarReader(t, entries), t.TempDir()))
+	})
+	t.Run("ratio", func(t *testing.T) {
+		dir := t.TempDir()
+		archive := filepath.Join(dir, "bomb.tar.gz")
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		body := make([]byte, 4<<20)
+		xt.NoError(t, tw.WriteHeader(&tar.Header{Name: "zero", Typeflag: tar.TypeReg, Size: int64(len(body)), Mode: 0644}))
+		_, err := tw.Write(body)
+		xt.NoError(t, err)
+		xt.NoError(t, tw.Close())
+		xt.NoError(t, zw.Close())
+		xt.NoError(t, os.WriteFile(archive, buf.Bytes(), 0644))
+
+		tr := &Tar{Limit: UnpackLimit{MaxRatio: 100}}
+		err = tr.Unpack(archive, filepath.Join(dir, "out"))
+		var le *LimitError
+		xt.True(t, errors.As(err, &le))
+		xt.Equal(t, "MaxRatio", le.Limit)
+
+		tr = &Tar{Limit: UnpackLimit{MaxRatio: 10000}}
+		xt.NoError(t, tr.Unpack(archive, filepath.Join(dir, "out")))
+	})
+}
+
+// testTarBzip2 是包含 a/b.txt（内容为 hello）的 tar 包，使用 bzip2 压缩
+var testTarBzip2 = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x87, 0x59,
+	0xf5, 0x03, 0x00, 0x00, 0x78, 0x7b, 0x90, 0xc9, 0x80, 0x00, 0x42, 0x40,
+	0x01, 0xf7, 0x00, 0x00, 0x20, 0x72, 0x44, 0x9e, 0x40, 0x04, 0x00, 0x00,
+	0x08, 0x20, 0x00, 0x54, 0x32, 0x50, 0x1a, 0x0d, 0x0f, 0x53, 0xd1, 0x03,
+	0x35, 0x04, 0x92, 0x8f, 0x50, 0x1a, 0x0d, 0x03, 0x46, 0x81, 0x33, 0xe6,
+	0x83, 0xd2, 0x84, 0x1d, 0x54, 0x90, 0x91, 0x93, 0xe6, 0xc4, 0x67, 0x0b,
+	0xac, 0x40, 0x86, 0x13, 0x04, 0xa5, 0x17, 0x42, 0x38, 0xbf, 0x84, 0x06,
+	0xdd, 0x52, 0x56, 0x24, 0x67, 0xce, 0x05, 0x9a, 0x7e, 0x3f, 0xbf, 0x09,
+	0x0e, 0xc3, 0x2a, 0xd6, 0xe0, 0xef, 0x57, 0xdd, 0x49, 0x20, 0x7e, 0x2e,
+	0xe4, 0x8a, 0x70, 0xa1, 0x21, 0x0e, 0xb3, 0xea, 0x06,
+}
+
+func TestTar_UnpackCompress(t *testing.T) {
+	var raw bytes.Buffer
+	tw := tar.NewWriter(&raw)
+	xt.NoError(t, tw.WriteHeader(&tar.Header{Name: "a/b.txt", Typeflag: tar.TypeReg, Size: 5, Mode: 0644}))
+	_, err := tw.Write([]byte("hello"))
+	xt.NoError(t, err)
+	xt.NoError(t, tw.Close())
+
+	compress := func(t *testing.T, newWriter func(w io.Writer) (io.WriteCloser, error)) []byte {
+		var buf bytes.Buffer
+		w, err := newWriter(&buf)
+		xt.NoError(t, err)
+		_, err = w.Write(raw.Bytes())
+		xt.NoError(t, err)
+		xt.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+	cases := map[string][]byte{
+		"none": raw.Bytes(),
+		"gzip": compress(t, func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		}),
+		"bzip2": testTarBzip2,
+		"xz": compress(t, func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		}),
+		"zstd": compress(t, func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		}),
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			// 文件没有后缀，只能通过 magic bytes 识别
+			archive := filepath.Join(dir, "archive")
+			xt.NoError(t, os.WriteFile(archive, data, 0644))
+			tr := &Tar{}
+			xt.NoError(t, tr.Unpack(archive, filepath.Join(dir, "out")))
+			xt.Equal(t, "hello", readTestFile(t, filepath.Join(dir, "out", "a", "b.txt")))
+		})
+	}
+
+	t.Run("name like bzip2", func(t *testing.T) {
+		// 未压缩的 tar 以第一个文件的文件名开头
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		xt.NoError(t, tw.WriteHeader(&tar.Header{Name: "BZh-notes.txt", Typeflag: tar.TypeReg, Size: 5, Mode: 0644}))
+		_, err := tw.Write([]byte("notes"))
+		xt.NoError(t, err)
+		xt.NoError(t, tw.Close())
+
+		dir := t.TempDir()
+		archive := filepath.Join(dir, "archive")
+		xt.NoError(t, os.WriteFile(archive, buf.Bytes(), 0644))
+		xt.NoError(t, (&Tar{}).Unpack(archive, filepath.Join(dir, "out1")))
+		xt.Equal(t, "notes", readTestFile(t, filepath.Join(dir, "out1", "BZh-notes.txt")))
+		xt.NoError(t, Unpack(archive, filepath.Join(dir, "out2"), nil))
+		xt.Equal(t, "notes", readTestFile(t, filepath.Join(dir, "out2", "BZh-notes.txt")))
+	})
+}
+
+func TestTar_List(t *testing.T) {
+	entries := []testTarEntry{
+		{name: "pkg/", typeflag: tar.TypeDir},
+		{name: "pkg/bin/", typeflag: tar.TypeDir},
+		{name: "pkg/bin/tool", typeflag: tar.TypeReg, body: "tool"},
+		{name: "pkg/bin/t", typeflag: tar.TypeSymlink, link: "tool"},
+		{name: "pkg/bin/t2", typeflag: tar.TypeLink, link: "pkg/bin/tool"},
+		{name: "pkg/README", typeflag: tar.TypeReg, body: "r"},
+	}
+	tr := &Tar{
+		StripComponents: 1,
+		MinSize:         2,
+		UnpackNextBefore: func(h *tar.Header) (skip bool, err error) {
+			return h.Name == "pkg/bin/t2", nil
+		},
+	}
+	list, err := tr.ListFromReader(newTestTarReader(t, entries))
+	xt.NoError(t, err)
+	xt.Equal(t, 3, len(list))
+	xt.Equal(t, "pkg/bin/", list[0].Name)
+	xt.Equal(t, "bin", list[0].Path)
+	xt.Equal(t, EntryDir, list[0].Type)
+	xt.Equal(t, os.ModeDir|0755, list[0].Mode)
+	xt.Equal(t, "bin/tool", list[1].Path)
+	xt.Equal(t, EntryFile, list[1].Type)
+	xt.Equal(t, int64(4), list[1].Size)
+	xt.Equal(t, EntrySymlink, list[2].Type)
+	xt.Equal(t, "tool", list[2].Linkname)
+
+	list, err = (&Tar{}).ListFromReader(newTestTarReader(t, entries))
+	xt.NoError(t, err)
+	xt.Equal(t, 6, len(list))
+	xt.Equal(t, EntryHardlink, list[4].Type)
+	xt.Equal(t, "pkg/bin/tool", list[4].Linkname)
+
+	_, err = (&Tar{}).ListFromReader(newTestTarReader(t, []testTarEntry{
+		{name: "../x", typeflag: tar.TypeReg, body: "x"},
+	}))
+	var ue *UnsafePathError
+	xt.True(t, errors.As(err, &ue))
+}
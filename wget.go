@@ -36,6 +36,46 @@ type Wget struct {
 
 	// InsecureSkipVerify 是否跳过 tls 证书校验，可选
 	InsecureSkipVerify bool
+
+	// Method 请求方法，可选，默认为 GET
+	Method string
+
+	// Body 请求的 body，可选，如 POST 的数据，重试时会重新发送
+	// 需要时通过 Header 设置 Content-Type
+	Body []byte
+
+	// Header 请求的 header，可选，如 User-Agent、Accept、自定义的 token 等
+	Header http.Header
+
+	// Username 和 Password 用于 Basic 认证，可选
+	Username string
+	Password string
+
+	// BearerToken 用于 Bearer 认证，可选，优先于 Username 和 Password
+	BearerToken string
+
+	// NetrcFile netrc 文件的路径，可选，如 "~/.netrc"
+	// 在没有配置其他认证信息时，按照 host 从中查找用户名和密码，用于 Basic 认证
+	NetrcFile string
+
+	// Resume Download 时是否断点续传，可选
+	// 为 true 时，先下载到 {dst}.part 文件，完成后再重命名为 dst，下载失败时会保留 .part 文件。
+	// 再次下载时，若之前的响应有 ETag 或者 Last-Modified，会使用 Range 和 If-Range 请求剩余的部分，
+	// 若服务端返回 206 则追加写入，返回 200 则重新下载
+	Resume bool
+
+	// Retry 失败后的重试策略，可选，为 nil 时不重试
+	Retry *WgetRetry
+
+	// Checksum Download 时期望的文件摘要，可选
+	// 格式为 "{算法}:{十六进制摘要}"，如 "sha256:e3b0c4..."，支持 sha256、sha512、sha1、md5，
+	// 也可以省略算法，按照摘要的长度判断。
+	// 摘要在下载时同时计算，不一致时会删除文件，并返回 *ChecksumError
+	Checksum string
+
+	// ChecksumURL 摘要文件的地址，可选，在 Checksum 为空时有效
+	// 如 {src}.sha256 或者 SHA256SUMS，会按照下载地址的文件名查找对应的摘要
+	ChecksumURL string
 }
 
 func (w *Wget) getProxy() func(*http.Request) (*url.URL, error) {
@@ -97,6 +137,13 @@ func (w *Wget) dialContext(ctx context.Context, network, addr string) (c net.Con
 
 // Download 从 src 这个地址下载到 dst 这个文件
 func (w *Wget) Download(src string, dst string) error {
+	return w.DownloadContext(context.Background(), src, dst)
+}
+
+// DownloadContext 从 src 这个地址下载到 dst 这个文件，ctx 取消时会立即停止下载
+//
+// 下载失败或者取消时，会删除 dst 文件，若是断点续传，则保留 .part 文件以便下次续传
+func (w *Wget) DownloadContext(ctx context.Context, src string, dst string) error {
 	if len(dst) == 0 {
 		return errors.New("empty output path")
 	}
@@ -105,6 +152,24 @@ func (w *Wget) Download(src string, dst string) error {
 		return err
 	}
 
+	cs, err := w.getChecksum(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	if w.Resume {
+		// 重试时会从已下载的部分继续
+		err = w.withRetry(ctx, func() error {
+			return w.downloadResume(ctx, src, dst, cs)
+		})
+		if err == nil && cs != nil {
+			if err = cs.verify(); err != nil {
+				os.Remove(dst)
+			}
+		}
+		return err
+	}
+
 	dstFile, err := os.Create(dst)
 	if err != nil {
 		return err
@@ -117,10 +182,38 @@ func (w *Wget) Download(src string, dst string) error {
 	}()
 
 	bw := bufio.NewWriter(dstFile)
-	if err = w.DownloadToWriter(src, bw); err != nil {
+	var out io.Writer = bw
+	if cs != nil {
+		out = io.MultiWriter(bw, cs.hash)
+	}
+	var retried bool
+	err = w.withRetry(ctx, func() error {
+		// 重试时从头写入
+		if retried {
+			bw.Reset(dstFile)
+			if _, err1 := dstFile.Seek(0, io.SeekStart); err1 != nil {
+				return &wgetFatalError{err: err1}
+			}
+			if err1 := dstFile.Truncate(0); err1 != nil {
+				return &wgetFatalError{err: err1}
+			}
+			if cs != nil {
+				cs.hash.Reset()
+			}
+		}
+		retried = true
+		return w.download(ctx, src, true, out)
+	})
+	if err != nil {
 		return err
 	}
 
+	if cs != nil {
+		if err = cs.verify(); err != nil {
+			return err
+		}
+	}
+
 	if err = bw.Flush(); err != nil {
 		return err
 	}
@@ -129,26 +222,56 @@ func (w *Wget) Download(src string, dst string) error {
 }
 
 // DownloadToWriter 下载数据并写入指定的 writer
+//
+// 若配置了 Retry，只有在还没有向 dst 写入数据时失败才会重试
 func (w *Wget) DownloadToWriter(src string, dst io.Writer) error {
-	client := w.getClient()
+	return w.DownloadToWriterContext(context.Background(), src, dst)
+}
 
-	res, err := client.Get(src)
+// DownloadToWriterContext 下载数据并写入指定的 writer，ctx 取消时会立即停止下载
+func (w *Wget) DownloadToWriterContext(ctx context.Context, src string, dst io.Writer) error {
+	cw := &countWriter{w: dst}
+	return w.withRetry(ctx, func() error {
+		err := w.download(ctx, src, true, cw)
+		if err != nil && cw.n > 0 {
+			return &wgetFatalError{err: err}
+		}
+		return err
+	})
+}
+
+// download 下载 src 并写入 dst，withBody 的含义同 newRequest
+func (w *Wget) download(ctx context.Context, src string, withBody bool, dst io.Writer) error {
+	req, err := w.newRequest(ctx, src, withBody)
+	if err != nil {
+		return err
+	}
+	res, err := w.getClient().Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 	w.logit("resp.StatusCode", res.StatusCode)
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("invalid status code: %s", res.Status)
+		return newStatusError(res)
 	}
+	return w.copyBody(res, dst, 0)
+}
 
+// copyBody 将 res.Body 写入 dst，offset 是断点续传时已下载的部分的大小
+func (w *Wget) copyBody(res *http.Response, dst io.Writer, offset int64) error {
 	var pw *progressWriter
 	var ww io.Writer
 	if w.LogWriter != nil {
+		total := res.ContentLength
+		if total != -1 {
+			total += offset
+		}
 		pw = &progressWriter{
 			w:     dst,
 			po:    w.LogWriter,
-			total: res.ContentLength,
+			n:     offset,
+			total: total,
 		}
 		ww = pw
 	} else {
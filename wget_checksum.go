@@ -0,0 +1,196 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ChecksumError 下载的文件的摘要和期望的不一致
+type ChecksumError struct {
+	// Algorithm 摘要算法，如 sha256
+	Algorithm string
+
+	// Expected 期望的摘要，十六进制小写
+	Expected string
+
+	// Actual 实际的摘要，十六进制小写
+	Actual string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %s, actual %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+// checksum 期望的摘要
+type checksum struct {
+	algorithm string
+	expected  string
+	hash      hash.Hash
+}
+
+func (c *checksum) verify() error {
+	actual := hex.EncodeToString(c.hash.Sum(nil))
+	if actual != c.expected {
+		return &ChecksumError{Algorithm: c.algorithm, Expected: c.expected, Actual: actual}
+	}
+	return nil
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+}
+
+// hashAlgorithm 按照十六进制摘要的长度判断算法
+func hashAlgorithm(sum string) (string, error) {
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", fmt.Errorf("invalid checksum %q: %w", sum, err)
+	}
+	switch len(sum) {
+	case 32:
+		return "md5", nil
+	case 40:
+		return "sha1", nil
+	case 64:
+		return "sha256", nil
+	case 128:
+		return "sha512", nil
+	default:
+		return "", fmt.Errorf("invalid checksum %q", sum)
+	}
+}
+
+// parseChecksum 解析 "{算法}:{十六进制摘要}" 格式的摘要，也可以省略算法，按照摘要的长度判断
+func parseChecksum(str string) (*checksum, error) {
+	algorithm, sum, ok := strings.Cut(strings.TrimSpace(str), ":")
+	if !ok {
+		sum = algorithm
+		var err error
+		if algorithm, err = hashAlgorithm(sum); err != nil {
+			return nil, err
+		}
+	}
+	algorithm = strings.ToLower(algorithm)
+	sum = strings.ToLower(sum)
+	h, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = hex.DecodeString(sum); err != nil || len(sum) != 2*h.Size() {
+		return nil, fmt.Errorf("invalid %s checksum %q", algorithm, sum)
+	}
+	return &checksum{algorithm: algorithm, expected: sum, hash: h}, nil
+}
+
+// maxChecksumFileSize 摘要文件的最大大小
+const maxChecksumFileSize = 1 << 20
+
+// getChecksum 返回 src 期望的摘要，没有配置 Checksum 和 ChecksumURL 时返回 nil
+func (w *Wget) getChecksum(ctx context.Context, src string) (*checksum, error) {
+	if len(w.Checksum) > 0 {
+		return parseChecksum(w.Checksum)
+	}
+	if len(w.ChecksumURL) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	err := w.withRetry(ctx, func() error {
+		buf.Reset()
+		return w.download(ctx, w.ChecksumURL, false, &limitWriter{w: &buf, n: maxChecksumFileSize})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("download checksum file %s: %w", w.ChecksumURL, err)
+	}
+	name := src
+	if u, err := url.Parse(src); err == nil {
+		name = u.Path
+	}
+	sum, err := findChecksum(buf.String(), path.Base(name))
+	if err != nil {
+		return nil, fmt.Errorf("checksum file %s: %w", w.ChecksumURL, err)
+	}
+	return parseChecksum(sum)
+}
+
+// findChecksum 从摘要文件中查找文件 name 的摘要，支持以下格式：
+//  1. sha256sum 等命令的输出："{摘要}  {文件名}"，文件名前可以有 *
+//  2. BSD 风格："SHA256 ({文件名}) = {摘要}"
+//  3. 只有摘要
+//
+// 若文件中只有一个摘要，则不检查文件名
+func findChecksum(content string, name string) (string, error) {
+	type item struct {
+		sum  string
+		name string
+	}
+	var items []item
+	sc := bufio.NewScanner(strings.NewReader(content))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if before, sum, ok := strings.Cut(line, ") = "); ok {
+			if _, fn, ok := strings.Cut(before, " ("); ok {
+				items = append(items, item{sum: strings.TrimSpace(sum), name: fn})
+				continue
+			}
+		}
+		fields := strings.Fields(line)
+		it := item{sum: fields[0]}
+		if len(fields) > 1 {
+			it.name = strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		}
+		items = append(items, it)
+	}
+	if len(items) == 1 {
+		return items[0].sum, nil
+	}
+	for _, it := range items {
+		if it.name == name || path.Base(it.name) == name {
+			return it.sum, nil
+		}
+	}
+	return "", fmt.Errorf("no checksum found for %q", name)
+}
+
+// limitWriter 最多写入 n 字节，超出时返回错误
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > lw.n {
+		return 0, errors.New("checksum file is too large")
+	}
+	lw.n -= int64(len(p))
+	return lw.w.Write(p)
+}
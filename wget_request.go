@@ -0,0 +1,145 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// newRequest 创建请求 src 的 http.Request
+// withBody 为 false 时（如下载摘要文件），不使用 Method 和 Body，总是使用 GET 请求
+func (w *Wget) newRequest(ctx context.Context, src string, withBody bool) (*http.Request, error) {
+	method := http.MethodGet
+	var body *bytes.Reader
+	if withBody {
+		if len(w.Method) > 0 {
+			method = w.Method
+		}
+		if w.Body != nil {
+			body = bytes.NewReader(w.Body)
+		}
+	}
+	var req *http.Request
+	var err error
+	if body == nil {
+		req, err = http.NewRequestWithContext(ctx, method, src, nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, src, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range w.Header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	if len(req.Header.Get("Authorization")) > 0 {
+		return req, nil
+	}
+	switch {
+	case len(w.BearerToken) > 0:
+		req.Header.Set("Authorization", "Bearer "+w.BearerToken)
+	case len(w.Username) > 0 || len(w.Password) > 0:
+		req.SetBasicAuth(w.Username, w.Password)
+	case len(w.NetrcFile) > 0:
+		login, password, ok, err := readNetrc(w.NetrcFile, req.URL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			req.SetBasicAuth(login, password)
+		}
+	}
+	return req, nil
+}
+
+// readNetrc 从 netrc 文件中查找 host 的用户名和密码，文件不存在时返回 ok=false
+func readNetrc(name string, host string) (login string, password string, ok bool, err error) {
+	if rest, found := strings.CutPrefix(name, "~/"); found {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false, err
+		}
+		name = filepath.Join(home, rest)
+	}
+	bf, err := os.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", false, nil
+		}
+		return "", "", false, err
+	}
+	login, password, ok = parseNetrc(string(bf), host)
+	return login, password, ok, nil
+}
+
+// parseNetrc 解析 netrc 文件的内容，返回 host 的用户名和密码
+// 若没有 host 对应的 machine，则使用 default
+func parseNetrc(content string, host string) (login string, password string, ok bool) {
+	type entry struct {
+		login    string
+		password string
+	}
+	var cur, def *entry
+	var found *entry
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+			switch fields[j] {
+			case "machine":
+				cur = nil
+				if next() == host && found == nil {
+					cur = &entry{}
+					found = cur
+				}
+			case "default":
+				cur = nil
+				if def == nil {
+					cur = &entry{}
+					def = cur
+				}
+			case "login":
+				if v := next(); cur != nil {
+					cur.login = v
+				}
+			case "password":
+				if v := next(); cur != nil {
+					cur.password = v
+				}
+			case "account":
+				next()
+			case "macdef":
+				// 宏定义一直到空行结束
+				for i+1 < len(lines) && len(strings.TrimSpace(lines[i+1])) > 0 {
+					i++
+				}
+				j = len(fields)
+			default:
+				if strings.HasPrefix(fields[j], "#") {
+					j = len(fields)
+				}
+			}
+		}
+	}
+	if found == nil {
+		found = def
+	}
+	if found == nil {
+		return "", "", false
+	}
+	return found.login, found.password, true
+}
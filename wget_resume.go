@@ -0,0 +1,226 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// wgetPartMeta 断点续传时，和 .part 文件一起保存的响应信息，用于 If-Range
+type wgetPartMeta struct {
+	URL          string
+	ETag         string
+	LastModified string
+}
+
+// validator 返回 If-Range 的值，弱 ETag 不能用于 If-Range
+func (m *wgetPartMeta) validator() string {
+	if len(m.ETag) > 0 && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+func readPartMeta(name string) *wgetPartMeta {
+	bf, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	meta := &wgetPartMeta{}
+	if err = json.Unmarshal(bf, meta); err != nil {
+		return nil
+	}
+	return meta
+}
+
+func writePartMeta(name string, meta *wgetPartMeta) error {
+	if len(meta.validator()) == 0 {
+		// 没有可用于 If-Range 的信息，下次不能续传
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	bf, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, bf, 0644)
+}
+
+// parseContentRange 解析 206 和 416 响应的 Content-Range，如 "bytes 100-199/200"、"bytes */200"
+// 返回开始位置（没有时为 -1）和总大小（未知时为 -1）
+func parseContentRange(s string) (start int64, total int64, err error) {
+	rng, ok := strings.CutPrefix(s, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	rng, size, ok := strings.Cut(rng, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	start, total = -1, -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range %q: %w", s, err)
+		}
+	}
+	if rng != "*" {
+		first, _, _ := strings.Cut(rng, "-")
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range %q: %w", s, err)
+		}
+	}
+	return start, total, nil
+}
+
+// downloadResume 断点续传下载，先下载到 {dst}.part，完成后再重命名为 dst
+//
+// cs 不为 nil 时，会计算完整文件的摘要，但不校验
+func (w *Wget) downloadResume(ctx context.Context, src string, dst string, cs *checksum) error {
+	part := dst + ".part"
+	metaFile := part + ".json"
+
+	var offset int64
+	meta := readPartMeta(metaFile)
+	if info, err := os.Stat(part); err == nil && info.Mode().IsRegular() &&
+		meta != nil && meta.URL == src && len(meta.validator()) > 0 {
+		offset = info.Size()
+	}
+
+	req, err := w.newRequest(ctx, src, true)
+	if err != nil {
+		return err
+	}
+	// 避免 http.Transport 自动解压缩，以使 .part 文件的大小和服务端的数据一致
+	req.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", meta.validator())
+		w.logit("resume from", offset)
+	}
+	res, err := w.getClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	w.logit("resp.StatusCode", res.StatusCode)
+
+	total := res.ContentLength
+	switch {
+	case res.StatusCode == http.StatusOK:
+		offset = 0
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		start, size, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != offset {
+			return fmt.Errorf("invalid Content-Range %q, expected start at %d", res.Header.Get("Content-Range"), offset)
+		}
+		total = size
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// .part 可能已经下载完成，否则删除后重新下载
+		if _, size, err := parseContentRange(res.Header.Get("Content-Range")); err == nil && size == offset {
+			if err = hashFile(cs, part); err != nil {
+				return err
+			}
+			return w.finishPart(part, metaFile, dst)
+		}
+		if err = os.Remove(part); err != nil {
+			return err
+		}
+		return w.downloadResume(ctx, src, dst, cs)
+	default:
+		return newStatusError(res)
+	}
+
+	if offset == 0 {
+		meta = &wgetPartMeta{
+			URL:          src,
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+		}
+		if err = writePartMeta(metaFile, meta); err != nil {
+			return err
+		}
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	pf, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+
+	// 已下载的部分也需要计算摘要
+	if err = hashFile(cs, part); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(pf)
+	var out io.Writer = bw
+	if cs != nil {
+		out = io.MultiWriter(bw, cs.hash)
+	}
+	err = w.copyBody(res, out, offset)
+	// 下载失败时也保存已下载的部分，以便下次续传
+	if err1 := bw.Flush(); err == nil {
+		err = err1
+	}
+	if err1 := pf.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+
+	if total != -1 {
+		info, err := os.Stat(part)
+		if err != nil {
+			return err
+		}
+		if info.Size() != total {
+			return fmt.Errorf("downloaded %d bytes; expected %d", info.Size(), total)
+		}
+	}
+	return w.finishPart(part, metaFile, dst)
+}
+
+// hashFile 重置 cs 的摘要后，计算文件 name 的摘要，cs 可以为 nil
+func hashFile(cs *checksum, name string) error {
+	if cs == nil {
+		return nil
+	}
+	cs.hash.Reset()
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(cs.hash, f)
+	return err
+}
+
+func (w *Wget) finishPart(part string, metaFile string, dst string) error {
+	if err := os.Rename(part, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(metaFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
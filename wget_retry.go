@@ -0,0 +1,231 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// WgetRetry Wget 失败后的重试策略
+type WgetRetry struct {
+	// MaxAttempts 最多尝试的次数（包括第一次），<=1 时不重试
+	MaxAttempts int
+
+	// Backoff 第一次重试前的等待时间，之后每次翻倍，可选，默认为 1s
+	Backoff time.Duration
+
+	// MaxBackoff 等待时间的最大值，可选，默认为 30s
+	// 响应的 Retry-After 超过此值时，也只等待 MaxBackoff
+	MaxBackoff time.Duration
+
+	// Jitter 等待时间随机增减的比例，取值范围 [0,1]，可选
+	// 如 0.2 表示在 ±20% 的范围内随机，以避免多个客户端同时重试
+	Jitter float64
+
+	// RetryStatus 可以重试的 HTTP 状态码，可选，默认为 408、429、500、502、503、504
+	RetryStatus []int
+
+	// RetryError 判断 error 是否可以重试，可选
+	// 默认网络错误（连接失败、超时、连接中断等）可以重试，
+	// 其他错误（如不支持的协议、域名不存在、证书校验失败、取消）不重试
+	RetryError func(err error) bool
+}
+
+var defaultRetryStatus = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+func (r *WgetRetry) getBackoff() time.Duration {
+	if r.Backoff > 0 {
+		return r.Backoff
+	}
+	return time.Second
+}
+
+func (r *WgetRetry) getMaxBackoff() time.Duration {
+	if r.MaxBackoff > 0 {
+		return r.MaxBackoff
+	}
+	return 30 * time.Second
+}
+
+// wait 返回第 attempt 次（从 1 开始）失败后的等待时间
+func (r *WgetRetry) wait(attempt int, err error) time.Duration {
+	var se *wgetStatusError
+	if errors.As(err, &se) && se.retryAfter > 0 {
+		return min(se.retryAfter, r.getMaxBackoff())
+	}
+	d := r.getBackoff()
+	for i := 1; i < attempt && d < r.getMaxBackoff(); i++ {
+		d *= 2
+	}
+	d = min(d, r.getMaxBackoff())
+	if r.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + min(r.Jitter, 1)*(rand.Float64()*2-1)))
+	}
+	return d
+}
+
+func (r *WgetRetry) canRetry(err error) bool {
+	var fe *wgetFatalError
+	if errors.As(err, &fe) {
+		return false
+	}
+	var se *wgetStatusError
+	if errors.As(err, &se) {
+		status := r.RetryStatus
+		if len(status) == 0 {
+			status = defaultRetryStatus
+		}
+		return slices.Contains(status, se.code)
+	}
+	if r.RetryError != nil {
+		return r.RetryError(err)
+	}
+	return isNetworkError(err)
+}
+
+// isNetworkError 判断是否是可以重试的网络错误，如连接失败、超时、连接中断等
+func isNetworkError(err error) bool {
+	// url.Error 也实现了 net.Error，需要判断其内部的 error，
+	// 否则如 "unsupported protocol scheme" 这类错误也会被当做网络错误
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ce *tls.CertificateVerificationError
+	if errors.As(err, &ce) {
+		return false
+	}
+	var de *net.DNSError
+	if errors.As(err, &de) {
+		return de.IsTimeout || de.IsTemporary
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var oe *net.OpError
+	if errors.As(err, &oe) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// wgetStatusError 响应的状态码不符合预期
+type wgetStatusError struct {
+	code       int
+	status     string
+	retryAfter time.Duration
+}
+
+func newStatusError(res *http.Response) error {
+	return &wgetStatusError{
+		code:       res.StatusCode,
+		status:     res.Status,
+		retryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+	}
+}
+
+func (e *wgetStatusError) Error() string {
+	return "invalid status code: " + e.status
+}
+
+// parseRetryAfter 解析 Retry-After，其值可以是秒数或者 HTTP 时间，无效时返回 0
+func parseRetryAfter(v string) time.Duration {
+	if len(v) == 0 {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(sec, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// wgetFatalError 不可以重试的错误，如已经向 DownloadToWriter 的 dst 写入了数据
+type wgetFatalError struct {
+	err error
+}
+
+func (e *wgetFatalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *wgetFatalError) Unwrap() error {
+	return e.err
+}
+
+// withRetry 执行 fn，失败时按照 Retry 策略重试，ctx 取消后不再重试
+func (w *Wget) withRetry(ctx context.Context, fn func() error) error {
+	attempts := 1
+	if w.Retry != nil {
+		attempts = max(w.Retry.MaxAttempts, 1)
+	}
+	for i := 1; ; i++ {
+		if attempts > 1 {
+			w.logit("attempt", fmt.Sprintf("%d/%d", i, attempts))
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if i >= attempts || !w.Retry.canRetry(err) {
+			var fe *wgetFatalError
+			if errors.As(err, &fe) {
+				return fe.err
+			}
+			return err
+		}
+		if err1 := ctx.Err(); err1 != nil {
+			return err1
+		}
+		d := w.Retry.wait(i, err)
+		w.logit("attempt", i, "failed:", err, "retry after", d.String())
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// countWriter 记录写入的字节数
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,522 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xanygo/anygo/xt"
+)
+
+func TestWget_Resume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	etag := `"v1"`
+	var failOnce atomic.Bool
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if failOnce.CompareAndSwap(true, false) {
+			// 只返回一半数据后断开连接
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Content-Length", "10000")
+			_, _ = w.Write(content[:5000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "out", "a.bin")
+	wg := &Wget{Resume: true}
+
+	t.Run("resume", func(t *testing.T) {
+		ranges = nil
+		failOnce.Store(true)
+		xt.Error(t, wg.Download(ts.URL, dst))
+		info, err := os.Stat(dst + ".part")
+		xt.NoError(t, err)
+		xt.Equal(t, int64(5000), info.Size())
+
+		xt.NoError(t, wg.Download(ts.URL, dst))
+		xt.Equal(t, []string{"", "bytes=5000-"}, ranges)
+		bf, err := os.ReadFile(dst)
+		xt.NoError(t, err)
+		xt.True(t, bytes.Equal(content, bf))
+		_, err = os.Stat(dst + ".part")
+		xt.True(t, os.IsNotExist(err))
+		_, err = os.Stat(dst + ".part.json")
+		xt.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		failOnce.Store(true)
+		xt.Error(t, wg.Download(ts.URL, dst))
+		// 服务端的文件变化后，If-Range 不匹配，返回 200 和完整的数据
+		etag = `"v2"`
+		content = []byte(strings.Repeat("abcdefghij", 1000))
+		xt.NoError(t, wg.Download(ts.URL, dst))
+		bf, err := os.ReadFile(dst)
+		xt.NoError(t, err)
+		xt.True(t, bytes.Equal(content, bf))
+	})
+
+	t.Run("completed part", func(t *testing.T) {
+		xt.NoError(t, os.WriteFile(dst+".part", content, 0644))
+		xt.NoError(t, writePartMeta(dst+".part.json", &wgetPartMeta{URL: ts.URL, ETag: etag}))
+		xt.NoError(t, os.Remove(dst))
+		xt.NoError(t, wg.Download(ts.URL, dst))
+		bf, err := os.ReadFile(dst)
+		xt.NoError(t, err)
+		xt.True(t, bytes.Equal(content, bf))
+	})
+}
+
+func TestWget_Retry(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	var count atomic.Int32
+	var failures atomic.Int32
+	var failStatus atomic.Int32
+	var abort atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		if failures.Add(-1) >= 0 {
+			if abort.Load() {
+				w.Header().Set("Content-Length", "10000")
+				_, _ = w.Write(content[:5000])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(int(failStatus.Load()))
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer ts.Close()
+
+	reset := func(n int32, status int, abortBody bool) {
+		count.Store(0)
+		failures.Store(n)
+		failStatus.Store(int32(status))
+		abort.Store(abortBody)
+	}
+	var log bytes.Buffer
+	wg := &Wget{
+		LogWriter: &log,
+		Retry: &WgetRetry{
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+			MaxBackoff:  10 * time.Millisecond,
+			Jitter:      0.5,
+		},
+	}
+	dst := filepath.Join(t.TempDir(), "a.bin")
+
+	t.Run("status", func(t *testing.T) {
+		reset(2, http.StatusBadGateway, false)
+		xt.NoError(t, wg.Download(ts.URL, dst))
+		xt.Equal(t, int32(3), count.Load())
+		xt.Contains(t, log.String(), "attempt 3/3")
+		bf, err := os.ReadFile(dst)
+		xt.NoError(t, err)
+		xt.True(t, bytes.Equal(content, bf))
+
+		reset(3, http.StatusServiceUnavailable, false)
+		err = wg.DownloadToWriter(ts.URL, &bytes.Buffer{})
+		xt.Error(t, err)
+		xt.Contains(t, err.Error(), "503")
+		xt.Equal(t, int32(3), count.Load())
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		// Retry-After 超过 MaxBackoff 时，只等待 MaxBackoff
+		reset(1, http.StatusServiceUnavailable, false)
+		start := time.Now()
+		xt.NoError(t, wg.DownloadToWriter(ts.URL, &bytes.Buffer{}))
+		xt.Equal(t, int32(2), count.Load())
+		xt.True(t, time.Since(start) < 5*time.Second)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		reset(1, http.StatusNotFound, false)
+		xt.Error(t, wg.DownloadToWriter(ts.URL, &bytes.Buffer{}))
+		xt.Equal(t, int32(1), count.Load())
+	})
+
+	t.Run("body", func(t *testing.T) {
+		// 已经写入了部分数据，DownloadToWriter 不能重试
+		reset(1, 0, true)
+		xt.Error(t, wg.DownloadToWriter(ts.URL, &bytes.Buffer{}))
+		xt.Equal(t, int32(1), count.Load())
+
+		// Download 会从头重新写入文件
+		reset(1, 0, true)
+		xt.NoError(t, wg.Download(ts.URL, dst))
+		xt.Equal(t, int32(2), count.Load())
+		bf, err := os.ReadFile(dst)
+		xt.NoError(t, err)
+		xt.True(t, bytes.Equal(content, bf))
+	})
+}
+
+func TestWgetRetry_canRetry(t *testing.T) {
+	r := &WgetRetry{}
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://127.0.0.1/", Err: err}
+	}
+	opErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{err: urlErr(opErr), want: true},
+		{err: urlErr(io.EOF), want: true},
+		{err: io.ErrUnexpectedEOF, want: true},
+		{err: fmt.Errorf("read body: %w", syscall.ECONNRESET), want: true},
+		{err: urlErr(context.DeadlineExceeded), want: true},
+		{err: urlErr(errors.New(`unsupported protocol scheme "ftp"`)), want: false},
+		{err: urlErr(context.Canceled), want: false},
+		{err: urlErr(&net.DNSError{Err: "no such host", Name: "a.invalid", IsNotFound: true}), want: false},
+		{err: urlErr(&net.DNSError{Err: "timeout", Name: "a.com", IsTimeout: true}), want: true},
+		{err: urlErr(&tls.CertificateVerificationError{Err: errors.New("bad")}), want: false},
+		{err: &wgetFatalError{err: io.ErrUnexpectedEOF}, want: false},
+		{err: errors.New("other"), want: false},
+	}
+	for _, c := range cases {
+		xt.Equal(t, c.want, r.canRetry(c.err))
+	}
+
+	var log bytes.Buffer
+	wg := &Wget{LogWriter: &log, Retry: &WgetRetry{MaxAttempts: 3, Backoff: time.Millisecond}}
+	xt.Error(t, wg.DownloadToWriter("ftp://127.0.0.1/a.txt", &bytes.Buffer{}))
+	xt.Contains(t, log.String(), "attempt 1/3")
+	xt.False(t, strings.Contains(log.String(), "attempt 2/3"))
+}
+
+func TestWgetRetry_wait(t *testing.T) {
+	r := &WgetRetry{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	xt.Equal(t, time.Second, r.wait(1, nil))
+	xt.Equal(t, 4*time.Second, r.wait(3, nil))
+	xt.Equal(t, 5*time.Second, r.wait(10, nil))
+
+	res := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	res.Header.Set("Retry-After", "3")
+	xt.Equal(t, 3*time.Second, r.wait(1, newStatusError(res)))
+
+	// 不超过 MaxBackoff
+	res.Header.Set("Retry-After", "86400")
+	xt.Equal(t, 5*time.Second, r.wait(1, newStatusError(res)))
+
+	res.Header.Set("Retry-After", time.Now().Add(4*time.Second).UTC().Format(http.TimeFormat))
+	d := r.wait(1, newStatusError(res))
+	xt.True(t, d > 2*time.Second && d <= 4*time.Second)
+
+	res.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	xt.Equal(t, 5*time.Second, r.wait(1, newStatusError(res)))
+
+	r.Jitter = 0.5
+	for range 100 {
+		d := r.wait(1, nil)
+		xt.True(t, d >= 500*time.Millisecond && d <= 1500*time.Millisecond)
+	}
+}
+
+func TestWget_Checksum(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	sum := sha256.Sum256(content)
+	hexSum := hex.EncodeToString(sum[:])
+	var failOnce atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/SHA256SUMS":
+			fmt.Fprintf(w, "%s  other.bin\n%s *a.bin\n", strings.Repeat("0", 64), hexSum)
+			return
+		case "/a.bin.sha256":
+			fmt.Fprintln(w, hexSum)
+			return
+		}
+		if failOnce.CompareAndSwap(true, false) {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", "10000")
+			_, _ = w.Write(content[:5000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	src := ts.URL + "/a.bin"
+
+	t.Run("match", func(t *testing.T) {
+		dst := filepath.Join(dir, "match.bin")
+		wg := &Wget{Checksum: "sha256:" + strings.ToUpper(hexSum)}
+		xt.NoError(t, wg.Download(src, dst))
+		bf, err := os.ReadFile(dst)
+		xt.NoError(t, err)
+		xt.True(t, bytes.Equal(content, bf))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		dst := filepath.Join(dir, "mismatch.bin")
+		expected := strings.Repeat("ab", 32)
+		wg := &Wget{Checksum: expected}
+		err := wg.Download(src, dst)
+		var ce *ChecksumError
+		xt.True(t, errors.As(err, &ce))
+		xt.Equal(t, "sha256", ce.Algorithm)
+		xt.Equal(t, expected, ce.Expected)
+		xt.Equal(t, hexSum, ce.Actual)
+		_, err = os.Stat(dst)
+		xt.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		wg := &Wget{Checksum: "crc32:1234"}
+		xt.Error(t, wg.Download(src, filepath.Join(dir, "invalid.bin")))
+	})
+
+	t.Run("ChecksumURL", func(t *testing.T) {
+		for _, name := range []string{"SHA256SUMS", "a.bin.sha256"} {
+			dst := filepath.Join(dir, name+".bin")
+			wg := &Wget{ChecksumURL: ts.URL + "/" + name}
+			xt.NoError(t, wg.Download(src, dst))
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		dst := filepath.Join(dir, "resume.bin")
+		wg := &Wget{Resume: true, Checksum: "sha256:" + hexSum}
+		failOnce.Store(true)
+		xt.Error(t, wg.Download(src, dst))
+		xt.NoError(t, wg.Download(src, dst))
+		bf, err := os.ReadFile(dst)
+		xt.NoError(t, err)
+		xt.True(t, bytes.Equal(content, bf))
+
+		wg.Checksum = "md5:" + strings.Repeat("0", 32)
+		var ce *ChecksumError
+		xt.True(t, errors.As(wg.Download(src, dst), &ce))
+		_, err = os.Stat(dst)
+		xt.True(t, os.IsNotExist(err))
+	})
+}
+
+func Test_findChecksum(t *testing.T) {
+	content := `# comment
+aaa  a.bin
+bbb *dir/b.bin
+SHA256 (c.bin) = ccc
+`
+	for name, want := range map[string]string{"a.bin": "aaa", "b.bin": "bbb", "c.bin": "ccc"} {
+		got, err := findChecksum(content, name)
+		xt.NoError(t, err)
+		xt.Equal(t, want, got)
+	}
+	_, err := findChecksum(content, "d.bin")
+	xt.Error(t, err)
+
+	got, err := findChecksum("ddd\n", "any.bin")
+	xt.NoError(t, err)
+	xt.Equal(t, "ddd", got)
+}
+
+func TestWget_DownloadContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/busy" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// 只返回一部分数据，然后一直等待
+		w.Header().Set("Content-Length", "10000")
+		_, _ = w.Write(make([]byte, 100))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+
+	t.Run("cancel body", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		dst := filepath.Join(dir, "a.bin")
+		err := (&Wget{LogWriter: cancelOnProgress(cancel)}).DownloadContext(ctx, ts.URL, dst)
+		xt.True(t, errors.Is(err, context.Canceled))
+		_, err = os.Stat(dst)
+		xt.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("cancel resume", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		dst := filepath.Join(dir, "b.bin")
+		err := (&Wget{Resume: true, LogWriter: cancelOnProgress(cancel)}).DownloadContext(ctx, ts.URL, dst)
+		xt.True(t, errors.Is(err, context.Canceled))
+		_, err = os.Stat(dst)
+		xt.True(t, os.IsNotExist(err))
+		// 保留 .part 文件以便续传
+		info, err := os.Stat(dst + ".part")
+		xt.NoError(t, err)
+		xt.Equal(t, int64(100), info.Size())
+	})
+
+	t.Run("cancel retry", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		wg := &Wget{Retry: &WgetRetry{MaxAttempts: 5, Backoff: time.Minute}}
+		start := time.Now()
+		err := wg.DownloadContext(ctx, ts.URL+"/busy", filepath.Join(dir, "c.bin"))
+		xt.True(t, errors.Is(err, context.DeadlineExceeded))
+		xt.True(t, time.Since(start) < 10*time.Second)
+	})
+
+	t.Run("DownloadToWriterContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var buf bytes.Buffer
+		err := (&Wget{LogWriter: cancelOnProgress(cancel)}).DownloadToWriterContext(ctx, ts.URL, &buf)
+		xt.True(t, errors.Is(err, context.Canceled))
+		xt.Equal(t, 100, buf.Len())
+	})
+}
+
+// cancelOnProgress 返回的 writer 在输出下载进度时执行 cancel，即已经收到部分数据
+func cancelOnProgress(cancel context.CancelFunc) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		if bytes.HasPrefix(p, []byte("Downloaded")) {
+			cancel()
+		}
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestWget_Request(t *testing.T) {
+	var fails atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if fails.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "%s %s ua=%s auth=%s body=%s", r.Method, r.URL.Path,
+			r.Header.Get("User-Agent"), r.Header.Get("Authorization"), body)
+	}))
+	defer ts.Close()
+
+	get := func(t *testing.T, wg *Wget, path string) string {
+		var buf bytes.Buffer
+		xt.NoError(t, wg.DownloadToWriter(ts.URL+path, &buf))
+		return buf.String()
+	}
+
+	t.Run("header", func(t *testing.T) {
+		wg := &Wget{Header: http.Header{"User-Agent": {"demo/1.0"}}}
+		xt.Equal(t, "GET / ua=demo/1.0 auth= body=", get(t, wg, "/"))
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		xt.Equal(t, "GET / ua=Go-http-client/1.1 auth=Bearer abc body=",
+			get(t, &Wget{BearerToken: "abc", Username: "u"}, "/"))
+		xt.Equal(t, "GET / ua=Go-http-client/1.1 auth=Basic dTpw body=",
+			get(t, &Wget{Username: "u", Password: "p"}, "/"))
+		wg := &Wget{
+			BearerToken: "abc",
+			Header:      http.Header{"Authorization": {"Token xyz"}},
+		}
+		xt.Equal(t, "GET / ua=Go-http-client/1.1 auth=Token xyz body=", get(t, wg, "/"))
+	})
+
+	t.Run("netrc", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "netrc")
+		content := "machine example.com login a password b\nmachine 127.0.0.1\n  login u\n  password p\n"
+		xt.NoError(t, os.WriteFile(name, []byte(content), 0600))
+		xt.Equal(t, "GET / ua=Go-http-client/1.1 auth=Basic dTpw body=",
+			get(t, &Wget{NetrcFile: name}, "/"))
+		xt.Equal(t, "GET / ua=Go-http-client/1.1 auth= body=",
+			get(t, &Wget{NetrcFile: name + ".not_exists"}, "/"))
+	})
+
+	t.Run("post with retry", func(t *testing.T) {
+		fails.Store(1)
+		wg := &Wget{
+			Method: http.MethodPost,
+			Body:   []byte("k=v"),
+			Retry:  &WgetRetry{MaxAttempts: 2, Backoff: time.Millisecond},
+		}
+		xt.Equal(t, "POST /a ua=Go-http-client/1.1 auth= body=k=v", get(t, wg, "/a"))
+	})
+
+	t.Run("checksum file uses GET", func(t *testing.T) {
+		wg := &Wget{
+			Method:      http.MethodPost,
+			Body:        []byte("k=v"),
+			ChecksumURL: ts.URL + "/sum",
+		}
+		// 摘要文件的内容不是有效的摘要
+		err := wg.Download(ts.URL+"/a", filepath.Join(t.TempDir(), "a.txt"))
+		xt.Error(t, err)
+		xt.Contains(t, err.Error(), `"GET"`)
+	})
+}
+
+func Test_parseNetrc(t *testing.T) {
+	content := `# comment
+machine a.com login u1 password p1
+macdef init
+  machine b.com login x password y
+
+machine b.com
+	login u2
+	account acc
+	password p2
+default login u3 password p3
+`
+	cases := []struct {
+		host     string
+		login    string
+		password string
+	}{
+		{host: "a.com", login: "u1", password: "p1"},
+		{host: "b.com", login: "u2", password: "p2"},
+		{host: "c.com", login: "u3", password: "p3"},
+	}
+	for _, c := range cases {
+		login, password, ok := parseNetrc(content, c.host)
+		xt.True(t, ok)
+		xt.Equal(t, c.login, login)
+		xt.Equal(t, c.password, password)
+	}
+	_, _, ok := parseNetrc("machine a.com login u password p", "b.com")
+	xt.False(t, ok)
+}
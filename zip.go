@@ -6,12 +6,16 @@ package cmdutil
 
 import (
 	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
-// Zip 解压缩 .zip 文件
+// Zip .zip 文件工具，支持打包和解包
 type Zip struct {
 	// UnpackNextBefore 在 Unpack 时，解析到下一个 Header 后，实际 unpack 前的回调
 	UnpackNextBefore func(f *zip.File) (skip bool, err error)
@@ -19,17 +23,36 @@ type Zip struct {
 	// UnpackNextAfter 在 Unpack 时，解析到下一个 Header 后，实际 unpack 后的回调
 	UnpackNextAfter func(f *zip.File, err error) error
 
+	// PackNextBefore 在 Pack 时，生成下一个文件的 Header 后，实际写入前的回调
+	// 可以修改 h 的内容（如 Method），若 skip=true，则忽略该文件，若是目录，则整个目录都会被忽略
+	PackNextBefore func(h *zip.FileHeader) (skip bool, err error)
+
+	// PackNextAfter 在 Pack 时，生成下一个文件的 Header 后，实际写入后的回调
+	PackNextAfter func(h *zip.FileHeader, err error) error
+
+	// PackMethod Pack 时普通文件的压缩方法，可选，默认为 zip.Deflate
+	// 如对于已经压缩过的文件（.gz、.png 等）可以返回 zip.Store。目录和符号链接总是使用 zip.Store
+	PackMethod func(h *zip.FileHeader) uint16
+
 	// StripComponents Unpack 的时候，忽略掉前 N 层目录
+	// Pack 的时候，忽略掉文件在 zip 包中的路径的前 N 层目录
 	StripComponents uint
 
+	// PackPrefix Pack 的时候，在文件在 zip 包中的路径前添加的目录，可选
+	// 在 StripComponents 之后处理
+	PackPrefix string
+
 	// MinSize 最小文件大小，>0 时有效
 	MinSize int64
 
 	// MaxSize 最小文件大小，>0 时有效
 	MaxSize int64
 
+	// Limit Unpack 时的限制，用于防止压缩炸弹，可选
+	Limit UnpackLimit
+
 	// IgnoreFailed 是否忽略异常
-	// 不会忽略 UnpackNextBefore 返回的 error
+	// 不会忽略 UnpackNextBefore、PackNextBefore 返回的 error，以及超出 Limit 的 error
 	IgnoreFailed bool
 }
 
@@ -57,27 +80,121 @@ func (zp *Zip) Unpack(archiveFile string, targetDir string) error {
 }
 
 // UnpackFromReader 解压 zip.Reader
+//
+// 会恢复文件的权限和修改时间，以及 Unix 下创建的 zip 包中的符号链接
 func (zp *Zip) UnpackFromReader(zrd *zip.Reader, targetDir string) error {
-	for _, f := range zrd.File {
-		if zp.checkMinMaxIgnore(f) {
-			continue
+	ul := &unpackLimiter{limit: zp.Limit}
+	var dirs []zipDirMeta
+	if _, err := zp.unpackFiles(zrd.File, targetDir, ul, &dirs); err != nil {
+		return err
+	}
+	return zp.setDirMeta(dirs)
+}
+
+// unpackFiles 依次解压 files，返回成功解压了的文件的路径，key 是文件在 zip 包中的名字
+func (zp *Zip) unpackFiles(files []*zip.File, targetDir string, ul *unpackLimiter, dirs *[]zipDirMeta) (map[string]string, error) {
+	done := make(map[string]string, len(files))
+	for _, f := range files {
+		outPath, err := zp.unpackNext(newZipEntry(f), targetDir, ul, dirs)
+		if err != nil {
+			return nil, err
 		}
-		if zp.UnpackNextBefore != nil {
-			if skip, err4 := zp.UnpackNextBefore(f); skip {
-				continue
-			} else if err4 != nil {
-				return err4
-			}
+		if len(outPath) > 0 {
+			done[f.Name] = outPath
 		}
+	}
+	return done, nil
+}
+
+// zipEntry 待解压的文件
+type zipEntry struct {
+	// f 文件信息，从数据流解压时，只有 f.FileHeader 有效
+	f *zip.File
+
+	// open 打开文件的数据
+	open func() (io.ReadCloser, error)
+
+	// compressed 返回文件压缩后的大小，用于检查压缩比
+	compressed func() int64
+
+	// sizeUnknown 从数据流解压并且使用 Data Descriptor 时，Header 中的大小为 0，
+	// 需要按照实际解压的大小判断 MinSize、MaxSize
+	sizeUnknown bool
+}
 
-		err3 := zp.unpackOne(f, targetDir)
+// errZipSizeIgnored 实际解压的大小不满足 MinSize、MaxSize，文件需要忽略
+var errZipSizeIgnored = errors.New("zip file entry ignored by size")
 
-		if zp.UnpackNextAfter != nil {
-			err3 = zp.UnpackNextAfter(f, err3)
+func newZipEntry(f *zip.File) zipEntry {
+	return zipEntry{
+		f:    f,
+		open: f.Open,
+		compressed: func() int64 {
+			return int64(f.CompressedSize64)
+		},
+	}
+}
+
+// unpackNext 检查并解压一个文件，返回的 error 不为 nil 时需要终止解压
+// 若文件被成功解压，返回其路径
+func (zp *Zip) unpackNext(e zipEntry, targetDir string, ul *unpackLimiter, dirs *[]zipDirMeta) (string, error) {
+	f := e.f
+	if err := checkEntryName(f.Name); err != nil {
+		return "", err
+	}
+	if err := ul.checkEntry(f.Name, filepath.ToSlash(zp.unpackTo(f.Name))); err != nil {
+		return "", err
+	}
+	if !e.sizeUnknown && zp.checkMinMaxIgnore(f) {
+		return "", nil
+	}
+	if zp.UnpackNextBefore != nil {
+		if skip, err4 := zp.UnpackNextBefore(f); skip {
+			return "", nil
+		} else if err4 != nil {
+			return "", err4
 		}
+	}
 
-		if err3 != nil && !zp.IgnoreFailed {
-			return err3
+	outPath, err3 := zp.unpackOne(e, targetDir, ul, dirs)
+	if err3 == errZipSizeIgnored {
+		return "", nil
+	}
+
+	if zp.UnpackNextAfter != nil {
+		err3 = zp.UnpackNextAfter(f, err3)
+	}
+
+	if err3 != nil {
+		if !zp.IgnoreFailed || isLimitError(err3) {
+			return "", err3
+		}
+		return "", nil
+	}
+	return outPath, nil
+}
+
+// zipDirMeta 目录的权限和修改时间，在目录内的文件都解压完成后再设置，
+// 以避免写入文件时修改了目录的修改时间，以及目录没有写权限导致无法写入
+// mode 为 0 时表示没有权限信息，不修改权限
+type zipDirMeta struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (zp *Zip) setDirMeta(dirs []zipDirMeta) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		var err error
+		if d.mode != 0 {
+			err = os.Chmod(d.path, d.mode)
+		}
+		if err == nil && !d.modTime.IsZero() {
+			err = os.Chtimes(d.path, d.modTime, d.modTime)
+		}
+		if err != nil && !zp.IgnoreFailed {
+			return err
 		}
 	}
 	return nil
@@ -85,9 +202,13 @@ func (zp *Zip) UnpackFromReader(zrd *zip.Reader, targetDir string) error {
 
 func (zp *Zip) checkMinMaxIgnore(f *zip.File) bool {
 	if !f.FileInfo().Mode().IsRegular() {
-		return true
+		return false
 	}
-	size := f.FileInfo().Size()
+	return zp.checkSize(f.FileInfo().Size())
+}
+
+// checkSize 判断普通文件是否因为 MinSize、MaxSize 需要忽略
+func (zp *Zip) checkSize(size int64) bool {
 	if zp.MinSize > 0 && size < zp.MinSize {
 		return true
 	}
@@ -97,20 +218,70 @@ func (zp *Zip) checkMinMaxIgnore(f *zip.File) bool {
 	return false
 }
 
-func (zp *Zip) unpackOne(f *zip.File, targetDir string) error {
+const (
+	zipCreatorUnix   = 3
+	zipCreatorMacOSX = 19
+)
+
+// zipPerm 返回 zip 包中记录的权限，ok 为 false 时表示没有权限信息
+//
+// 只有创建者是 Unix 或者 macOS 时才记录了权限，其他的（如 FAT、NTFS）时，
+// Mode() 返回的是固定的 0666 或者 0777，不能使用
+func zipPerm(h *zip.FileHeader) (perm os.FileMode, ok bool) {
+	switch h.CreatorVersion >> 8 {
+	case zipCreatorUnix, zipCreatorMacOSX:
+		perm = h.Mode().Perm()
+		return perm, perm != 0
+	default:
+		return 0, false
+	}
+}
+
+// unpackOne 解压一个文件，返回解压后的路径，文件被忽略时返回空字符串
+func (zp *Zip) unpackOne(e zipEntry, targetDir string, ul *unpackLimiter, dirs *[]zipDirMeta) (string, error) {
+	f := e.f
 	to := zp.unpackTo(f.Name)
 	// 若是文件名为空，则此文件忽略掉
 	if len(to) == 0 {
-		return nil
+		return "", nil
 	}
 
-	outPath := filepath.Join(targetDir, to)
+	outPath, err := securePath(targetDir, filepath.ToSlash(to), f.Name)
+	if err != nil {
+		return "", err
+	}
 
-	if f.FileInfo().IsDir() {
-		return mkdir(outPath)
+	mode := f.Mode()
+	switch {
+	case mode.IsDir():
+		if err = mkdir(outPath); err != nil {
+			return "", err
+		}
+		perm, _ := zipPerm(&f.FileHeader)
+		*dirs = append(*dirs, zipDirMeta{path: outPath, mode: perm, modTime: f.Modified})
+	case mode&os.ModeSymlink != 0:
+		err = zp.unpackSymlink(e, outPath, targetDir, ul)
+	case mode.IsRegular():
+		err = zp.unpackRegular(e, outPath, ul)
+	default:
+		err = fmt.Errorf("zip file entry %s contained unsupported file type %v", f.Name, mode)
+	}
+	if err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
+
+func (zp *Zip) unpackRegular(e zipEntry, outPath string, ul *unpackLimiter) error {
+	f := e.f
+	// 先按照 Header 中的大小检查，实际解压时再按照写入的大小检查
+	if !e.sizeUnknown {
+		if err1 := ul.checkRatio(f.Name, int64(f.UncompressedSize64), e.compressed()); err1 != nil {
+			return err1
+		}
 	}
 
-	rc, err2 := f.Open()
+	rc, err2 := e.open()
 	if err2 != nil {
 		return err2
 	}
@@ -120,10 +291,155 @@ func (zp *Zip) unpackOne(f *zip.File, targetDir string) error {
 		return err3
 	}
 
-	out, err4 := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+	// 没有权限信息时，使用默认的权限，受 umask 影响
+	perm, hasPerm := zipPerm(&f.FileHeader)
+	if !hasPerm {
+		perm = 0666
+	}
+	out, err4 := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err4 != nil {
 		return err4
 	}
 	defer out.Close()
-	return copyFile(rc, out, -1)
+	src := ul.reader(f.Name, rc, e.compressed)
+	var cr *countReader
+	if e.sizeUnknown && (zp.MinSize > 0 || zp.MaxSize > 0) {
+		if zp.MaxSize > 0 {
+			// 超过 MaxSize 后不需要再写入
+			src = io.LimitReader(src, zp.MaxSize+1)
+		}
+		cr = &countReader{rd: src}
+		src = cr
+	}
+	if err5 := copyFile(src, out, -1); err5 != nil {
+		return err5
+	}
+	if cr != nil && zp.checkSize(cr.n) {
+		out.Close()
+		if err6 := os.Remove(outPath); err6 != nil {
+			return err6
+		}
+		return errZipSizeIgnored
+	}
+	// 文件已存在时 OpenFile 不会修改权限，并且创建时的权限受 umask 影响
+	if hasPerm {
+		if err6 := out.Chmod(perm); err6 != nil {
+			return err6
+		}
+	}
+	if !f.Modified.IsZero() {
+		return os.Chtimes(outPath, f.Modified, f.Modified)
+	}
+	return nil
+}
+
+// maxZipLinkSize 符号链接目标的最大长度
+const maxZipLinkSize = 4096
+
+// unpackSymlink 创建符号链接，zip 包中文件的内容是链接的目标，链接的目标必须在 targetDir 内
+func (zp *Zip) unpackSymlink(e zipEntry, outPath string, targetDir string, ul *unpackLimiter) error {
+	rc, err := e.open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	link, err := readZipLink(e.f.Name, ul.reader(e.f.Name, rc, e.compressed))
+	if err != nil {
+		return err
+	}
+	return createZipSymlink(e.f.Name, link, outPath, targetDir)
+}
+
+func readZipLink(name string, rd io.Reader) (string, error) {
+	bf, err := io.ReadAll(io.LimitReader(rd, maxZipLinkSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(bf) > maxZipLinkSize {
+		return "", fmt.Errorf("zip file entry %s contained too long link target", name)
+	}
+	return string(bf), nil
+}
+
+// createZipSymlink 在 outPath 创建指向 link 的符号链接，链接的目标必须在 targetDir 内
+func createZipSymlink(name string, link string, outPath string, targetDir string) error {
+	err := checkLinkTarget(targetDir, outPath, link, name)
+	if err != nil {
+		return err
+	}
+	if err = mkdir(filepath.Dir(outPath)); err != nil {
+		return err
+	}
+	if err = removeExists(outPath); err != nil {
+		return err
+	}
+	return os.Symlink(link, outPath)
+}
+
+// List 返回压缩包中会被解压的文件的信息，不会解压
+//
+// 和 Unpack 一样，会按照 StripComponents、MinSize、MaxSize、Limit 和 UnpackNextBefore 过滤
+func (zp *Zip) List(archiveFile string) ([]ArchiveEntry, error) {
+	zr, err := zip.OpenReader(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return zp.ListFromReader(&zr.Reader)
+}
+
+// ListFromReader 返回 zip.Reader 中会被解压的文件的信息
+func (zp *Zip) ListFromReader(zrd *zip.Reader) ([]ArchiveEntry, error) {
+	ul := &unpackLimiter{limit: zp.Limit}
+	var list []ArchiveEntry
+	for _, f := range zrd.File {
+		if err := checkEntryName(f.Name); err != nil {
+			return nil, err
+		}
+		to := filepath.ToSlash(zp.unpackTo(f.Name))
+		if err := ul.checkEntry(f.Name, to); err != nil {
+			return nil, err
+		}
+		if zp.checkMinMaxIgnore(f) {
+			continue
+		}
+		if zp.UnpackNextBefore != nil {
+			if skip, err4 := zp.UnpackNextBefore(f); skip {
+				continue
+			} else if err4 != nil {
+				return nil, err4
+			}
+		}
+		if len(to) == 0 {
+			continue
+		}
+
+		mode := f.Mode()
+		entry := ArchiveEntry{
+			Name:    f.Name,
+			Path:    to,
+			Type:    entryType(mode),
+			Size:    int64(f.UncompressedSize64),
+			Mode:    mode,
+			ModTime: f.Modified,
+		}
+		if entry.Type == EntrySymlink {
+			link, err := zp.readLink(f)
+			if err != nil {
+				return nil, err
+			}
+			entry.Linkname = link
+		}
+		list = append(list, entry)
+	}
+	return list, nil
+}
+
+func (zp *Zip) readLink(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return readZipLink(f.Name, rc)
 }
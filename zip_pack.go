@@ -0,0 +1,214 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func (zp *Zip) packTo(name string) string {
+	name = strings.TrimSuffix(name, "/")
+	if zp.StripComponents > 0 {
+		sc := int(zp.StripComponents)
+		ps := strings.Split(name, "/")
+		if len(ps) <= sc {
+			return ""
+		}
+		name = strings.Join(ps[sc:], "/")
+	}
+	if len(zp.PackPrefix) > 0 {
+		name = path.Join(zp.PackPrefix, name)
+	}
+	return name
+}
+
+// Pack 将文件或者目录打包为 archiveFile
+//
+// 每个 src 在 zip 包中的路径为 {src 的文件名}/{相对于 src 的路径}，
+// 可以使用 StripComponents 和 PackPrefix 调整。
+// 会保存文件的 Unix 权限和修改时间，文件大于 4GB 时自动使用 Zip64 格式
+func (zp *Zip) Pack(archiveFile string, srcs ...string) (err error) {
+	if err = mkdir(filepath.Dir(archiveFile)); err != nil {
+		return err
+	}
+	zf, err := os.Create(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			zf.Close()
+			os.Remove(archiveFile)
+		}
+	}()
+
+	self, err := zf.Stat()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(zf)
+	zw := zip.NewWriter(bw)
+	if err = zp.packToWriter(zw, self, srcs); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	return zf.Close()
+}
+
+// PackToWriter 将文件或者目录打包写入 zip.Writer，不会调用 zw.Close
+func (zp *Zip) PackToWriter(zw *zip.Writer, srcs ...string) error {
+	return zp.packToWriter(zw, nil, srcs)
+}
+
+// packToWriter self 是正在写入的 zip 文件自身，打包时会跳过，可以为 nil
+func (zp *Zip) packToWriter(zw *zip.Writer, self os.FileInfo, srcs []string) error {
+	if len(srcs) == 0 {
+		return errors.New("missing source path")
+	}
+	for _, src := range srcs {
+		if err := zp.packOne(zw, self, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (zp *Zip) packOne(zw *zip.Writer, self os.FileInfo, src string) error {
+	base := filepath.Base(src)
+	return filepath.WalkDir(src, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if zp.IgnoreFailed && fp != src {
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			if zp.IgnoreFailed {
+				return nil
+			}
+			return err
+		}
+		if self != nil && os.SameFile(self, info) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, fp)
+		if err != nil {
+			return err
+		}
+		h, err := zp.packHeader(path.Join(base, filepath.ToSlash(rel)), info)
+		if err != nil {
+			if zp.IgnoreFailed {
+				return nil
+			}
+			return err
+		}
+		if h == nil || (info.Mode().IsRegular() && zp.checkSize(info.Size())) {
+			return nil
+		}
+
+		if zp.PackNextBefore != nil {
+			if skip, err4 := zp.PackNextBefore(h); skip {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			} else if err4 != nil {
+				return err4
+			}
+		}
+
+		err3 := zp.packEntry(zw, fp, info, h)
+
+		if zp.PackNextAfter != nil {
+			err3 = zp.PackNextAfter(h, err3)
+		}
+
+		if err3 != nil && !zp.IgnoreFailed {
+			return err3
+		}
+		return nil
+	})
+}
+
+// packHeader 生成文件在 zip 中的 Header，若返回 nil 表示需要忽略
+func (zp *Zip) packHeader(name string, info os.FileInfo) (*zip.FileHeader, error) {
+	to := zp.packTo(name)
+	if len(to) == 0 {
+		return nil, nil
+	}
+	mode := info.Mode()
+	if !mode.IsRegular() && !mode.IsDir() && mode&os.ModeSymlink == 0 {
+		return nil, fmt.Errorf("%s: unsupported file type %v", name, mode)
+	}
+	h, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	h.Name = to
+	h.Method = zip.Store
+	switch {
+	case info.IsDir():
+		h.Name += "/"
+	case mode.IsRegular():
+		h.Method = zip.Deflate
+		if zp.PackMethod != nil {
+			h.Method = zp.PackMethod(h)
+		}
+	}
+	return h, nil
+}
+
+func (zp *Zip) packEntry(zw *zip.Writer, fp string, info os.FileInfo, h *zip.FileHeader) error {
+	mode := info.Mode()
+	switch {
+	case mode&os.ModeSymlink != 0:
+		// 符号链接的目标作为文件内容
+		link, err := os.Readlink(fp)
+		if err != nil {
+			return err
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, filepath.ToSlash(link))
+		return err
+	case mode.IsRegular():
+		// 先打开文件再写 Header，以避免打开失败时 zip 中只有 Header 而没有内容
+		f, err := os.Open(fp)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		if _, err = io.CopyN(w, f, info.Size()); err != nil {
+			return fmt.Errorf("error reading from %s: %w", fp, err)
+		}
+		return nil
+	default:
+		_, err := zw.CreateHeader(h)
+		return err
+	}
+}
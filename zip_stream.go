@@ -0,0 +1,443 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	zipFileHeaderSignature      = 0x04034b50
+	zipDirectoryHeaderSignature = 0x02014b50
+	zipDataDescriptorSignature  = 0x08074b50
+	zipDirectoryEndSignature    = 0x06054b50
+
+	zipFileHeaderLen      = 30
+	zipDirectoryHeaderLen = 46
+
+	zipFlagEncrypted      = 0x1
+	zipFlagDataDescriptor = 0x8
+
+	zip64ExtraID      = 0x0001
+	zipExtTimeExtraID = 0x5455
+)
+
+// UnpackFromStream 从不支持 Seek 的数据流（如 HTTP Body、标准输入）中解压 zip 数据
+//
+// 按顺序读取每个文件的 Local File Header、数据和 Data Descriptor 并解压，
+// 文件的权限和符号链接只记录在末尾的 Central Directory 中，读取到后再设置。
+// 若遇到未压缩（Store）并且使用 Data Descriptor 记录大小的文件，无法确定其数据的结束位置，
+// 会将剩余的数据写入临时文件后再解压。
+// 配合 io.Pipe 和 Wget.DownloadToWriter，可以边下载边解压。
+//
+// UnpackNextBefore 和 UnpackNextAfter 的参数 f 只有 FileHeader 有效，不能调用 f.Open，
+// 并且 f.Mode() 总是普通文件或者目录。
+// 使用 Data Descriptor 记录大小的文件（如 zip.Writer 创建的），回调时 f 中的大小和 CRC32 为 0，
+// 会在解压时按照实际的大小判断 MinSize、MaxSize，不满足时删除已解压的文件，并且不会回调 UnpackNextAfter。
+// 符号链接在读取到 Central Directory 后才能识别，也会按照 MinSize、MaxSize 判断
+func (zp *Zip) UnpackFromStream(rd io.Reader, targetDir string) error {
+	zs := &zipStreamReader{br: bufio.NewReader(rd)}
+	ul := &unpackLimiter{limit: zp.Limit}
+	var dirs []zipDirMeta
+	done := map[string]string{}
+	for {
+		start := zs.n
+		var sig [4]byte
+		if _, err := io.ReadFull(zs, sig[:]); err != nil {
+			return fmt.Errorf("read zip stream: %w", noEOF(err))
+		}
+		switch binary.LittleEndian.Uint32(sig[:]) {
+		case zipFileHeaderSignature:
+			h, raw, err := readZipLocalHeader(zs)
+			if err != nil {
+				return err
+			}
+			if h.Flags&zipFlagDataDescriptor != 0 && h.Method != zip.Deflate {
+				return zp.unpackSpilled(zs, raw, start, targetDir, ul, dirs, done)
+			}
+			if err = zp.unpackStreamEntry(zs, h, targetDir, ul, &dirs, done); err != nil {
+				return err
+			}
+		case zipDirectoryHeaderSignature:
+			headers, err := readZipDirectory(zs)
+			if err != nil {
+				return err
+			}
+			if err = zp.setStreamMeta(headers, done, targetDir, dirs); err != nil {
+				return err
+			}
+			return zp.setDirMeta(dirs)
+		case zipDirectoryEndSignature:
+			// 没有文件的 zip 包
+			_, _ = io.Copy(io.Discard, zs)
+			return zp.setDirMeta(dirs)
+		default:
+			return fmt.Errorf("read zip stream at offset %d: %w", start, zip.ErrFormat)
+		}
+	}
+}
+
+// zipStreamReader 记录从数据流中读取的字节数
+//
+// 实现了 io.ByteReader，以使 flate 解压时不会读取超出当前文件的数据
+type zipStreamReader struct {
+	br *bufio.Reader
+	n  int64
+}
+
+func (zs *zipStreamReader) Read(p []byte) (int, error) {
+	n, err := zs.br.Read(p)
+	zs.n += int64(n)
+	return n, err
+}
+
+func (zs *zipStreamReader) ReadByte() (byte, error) {
+	b, err := zs.br.ReadByte()
+	if err == nil {
+		zs.n++
+	}
+	return b, err
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readZipLocalHeader 读取 Local File Header（不包括已读取的 signature），
+// 返回 Header 和其原始数据（包括 signature）
+func readZipLocalHeader(zs *zipStreamReader) (*zip.FileHeader, []byte, error) {
+	raw := make([]byte, zipFileHeaderLen)
+	binary.LittleEndian.PutUint32(raw, zipFileHeaderSignature)
+	if _, err := io.ReadFull(zs, raw[4:]); err != nil {
+		return nil, nil, fmt.Errorf("read zip file header: %w", noEOF(err))
+	}
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(raw[26:]))
+	extraLen := int(le.Uint16(raw[28:]))
+	raw = append(raw, make([]byte, nameLen+extraLen)...)
+	if _, err := io.ReadFull(zs, raw[zipFileHeaderLen:]); err != nil {
+		return nil, nil, fmt.Errorf("read zip file header: %w", noEOF(err))
+	}
+	h := &zip.FileHeader{
+		Name:               string(raw[zipFileHeaderLen : zipFileHeaderLen+nameLen]),
+		ReaderVersion:      le.Uint16(raw[4:]),
+		Flags:              le.Uint16(raw[6:]),
+		Method:             le.Uint16(raw[8:]),
+		ModifiedTime:       le.Uint16(raw[10:]),
+		ModifiedDate:       le.Uint16(raw[12:]),
+		CRC32:              le.Uint32(raw[14:]),
+		CompressedSize64:   uint64(le.Uint32(raw[18:])),
+		UncompressedSize64: uint64(le.Uint32(raw[22:])),
+		Extra:              raw[zipFileHeaderLen+nameLen:],
+		// 权限只记录在 Central Directory 中，此时按照 Unix 的未知权限处理，使用默认权限
+		CreatorVersion: zipCreatorUnix << 8,
+	}
+	if h.Flags&zipFlagEncrypted != 0 {
+		return nil, nil, fmt.Errorf("zip file entry %s is encrypted: %w", h.Name, zip.ErrAlgorithm)
+	}
+	h.Modified = time.Date(1980+int(h.ModifiedDate>>9), time.Month(h.ModifiedDate>>5&0xf), int(h.ModifiedDate&0x1f),
+		int(h.ModifiedTime>>11), int(h.ModifiedTime>>5&0x3f), int(h.ModifiedTime&0x1f*2), 0, time.UTC)
+	parseZipExtra(h)
+	return h, raw, nil
+}
+
+// parseZipExtra 解析 Extra 中的 Zip64 大小和修改时间
+func parseZipExtra(h *zip.FileHeader) {
+	le := binary.LittleEndian
+	extra := h.Extra
+	for len(extra) >= 4 {
+		id := le.Uint16(extra)
+		size := int(le.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+		switch id {
+		case zip64ExtraID:
+			if h.UncompressedSize64 == 0xffffffff && len(field) >= 8 {
+				h.UncompressedSize64 = le.Uint64(field)
+				field = field[8:]
+			}
+			if h.CompressedSize64 == 0xffffffff && len(field) >= 8 {
+				h.CompressedSize64 = le.Uint64(field)
+			}
+		case zipExtTimeExtraID:
+			if len(field) >= 5 && field[0]&1 != 0 {
+				h.Modified = time.Unix(int64(int32(le.Uint32(field[1:]))), 0)
+			}
+		}
+	}
+}
+
+// hasZip64Extra 判断 Extra 中是否有 Zip64 信息，若有，Data Descriptor 中的大小为 8 字节
+func hasZip64Extra(extra []byte) bool {
+	le := binary.LittleEndian
+	for len(extra) >= 4 {
+		if le.Uint16(extra) == zip64ExtraID {
+			return true
+		}
+		extra = extra[min(len(extra), 4+int(le.Uint16(extra[2:]))):]
+	}
+	return false
+}
+
+// unpackStreamEntry 解压数据流中的一个文件，并读取完此文件的所有数据
+func (zp *Zip) unpackStreamEntry(zs *zipStreamReader, h *zip.FileHeader, targetDir string, ul *unpackLimiter,
+	dirs *[]zipDirMeta, done map[string]string) error {
+	dd := h.Flags&zipFlagDataDescriptor != 0
+	start := zs.n
+	var data io.Reader = zs
+	if !dd {
+		data = io.LimitReader(zs, int64(h.CompressedSize64))
+	}
+
+	var rc io.ReadCloser
+	switch h.Method {
+	case zip.Store:
+		rc = io.NopCloser(data)
+	case zip.Deflate:
+		rc = flate.NewReader(data)
+	}
+	crc := crc32.NewIEEE()
+	// 解压后的大小，用于判断 Data Descriptor 的格式
+	cw := &countWriter{w: crc}
+	var body io.Reader
+	if rc != nil {
+		defer rc.Close()
+		body = io.TeeReader(rc, cw)
+	}
+
+	e := zipEntry{
+		f: &zip.File{FileHeader: *h},
+		open: func() (io.ReadCloser, error) {
+			if body == nil {
+				return nil, zip.ErrAlgorithm
+			}
+			return io.NopCloser(body), nil
+		},
+		compressed: func() int64 {
+			if dd {
+				return zs.n - start
+			}
+			return int64(h.CompressedSize64)
+		},
+		sizeUnknown: dd,
+	}
+	outPath, err := zp.unpackNext(e, targetDir, ul, dirs)
+	if err != nil {
+		return err
+	}
+	if len(outPath) > 0 {
+		done[h.Name] = outPath
+	}
+
+	// 文件可能被忽略或者没有读取完
+	if body != nil {
+		if _, err = io.Copy(io.Discard, body); err != nil {
+			return fmt.Errorf("zip file entry %s: %w", h.Name, err)
+		}
+	}
+	size := zs.n - start
+	if !dd {
+		if _, err = io.Copy(io.Discard, data); err != nil {
+			return fmt.Errorf("zip file entry %s: %w", h.Name, noEOF(err))
+		}
+	} else if err = readZipDataDescriptor(zs, h, isZip64Descriptor(h, size, cw.n)); err != nil {
+		return err
+	}
+	if body != nil && (dd || h.CRC32 != 0) && crc.Sum32() != h.CRC32 {
+		return fmt.Errorf("zip file entry %s: %w", h.Name, zip.ErrChecksum)
+	}
+	if dd && size != int64(h.CompressedSize64) {
+		return fmt.Errorf("zip file entry %s has wrong compressed size: %w", h.Name, zip.ErrFormat)
+	}
+	if dd && body != nil && cw.n != int64(h.UncompressedSize64) {
+		return fmt.Errorf("zip file entry %s has wrong uncompressed size: %w", h.Name, zip.ErrFormat)
+	}
+	return nil
+}
+
+// isZip64Descriptor 判断 Data Descriptor 中的大小是否为 8 字节，compressed、uncompressed 是实际的大小
+//
+// Go 的 zip.Writer 等流式写入时，Local File Header 中没有 Zip64 Extra，
+// 而是在大小达到 0xffffffff 时使用 8 字节的大小，所以也需要按照实际的大小判断
+func isZip64Descriptor(h *zip.FileHeader, compressed int64, uncompressed int64) bool {
+	const uint32max = 1<<32 - 1
+	return hasZip64Extra(h.Extra) || compressed >= uint32max || uncompressed >= uint32max
+}
+
+// readZipDataDescriptor 读取 Data Descriptor，并更新 h 中的 CRC32 和大小，zip64 为 true 时大小为 8 字节
+func readZipDataDescriptor(zs *zipStreamReader, h *zip.FileHeader, zip64 bool) error {
+	sizeLen := 4
+	if zip64 {
+		sizeLen = 8
+	}
+	buf := make([]byte, 4+2*sizeLen)
+	if _, err := io.ReadFull(zs, buf[:4]); err != nil {
+		return fmt.Errorf("read zip data descriptor: %w", noEOF(err))
+	}
+	le := binary.LittleEndian
+	// signature 是可选的，若没有，已读取的是 CRC32
+	rest := buf[4:]
+	if le.Uint32(buf) == zipDataDescriptorSignature {
+		rest = buf
+	}
+	if _, err := io.ReadFull(zs, rest); err != nil {
+		return fmt.Errorf("read zip data descriptor: %w", noEOF(err))
+	}
+	h.CRC32 = le.Uint32(buf)
+	if sizeLen == 8 {
+		h.CompressedSize64 = le.Uint64(buf[4:])
+		h.UncompressedSize64 = le.Uint64(buf[12:])
+	} else {
+		h.CompressedSize64 = uint64(le.Uint32(buf[4:]))
+		h.UncompressedSize64 = uint64(le.Uint32(buf[8:]))
+	}
+	return nil
+}
+
+// readZipDirectory 读取 Central Directory（第一条记录的 signature 已读取），
+// 返回的 Header 只包括 Name、CreatorVersion 和 ExternalAttrs
+func readZipDirectory(zs *zipStreamReader) ([]*zip.FileHeader, error) {
+	le := binary.LittleEndian
+	var headers []*zip.FileHeader
+	buf := make([]byte, zipDirectoryHeaderLen-4)
+	for {
+		if _, err := io.ReadFull(zs, buf); err != nil {
+			return nil, fmt.Errorf("read zip directory: %w", noEOF(err))
+		}
+		nameLen := int(le.Uint16(buf[24:]))
+		skipLen := int64(le.Uint16(buf[26:])) + int64(le.Uint16(buf[28:]))
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(zs, name); err != nil {
+			return nil, fmt.Errorf("read zip directory: %w", noEOF(err))
+		}
+		if _, err := io.CopyN(io.Discard, zs, skipLen); err != nil {
+			return nil, fmt.Errorf("read zip directory: %w", noEOF(err))
+		}
+		headers = append(headers, &zip.FileHeader{
+			Name:           string(name),
+			CreatorVersion: le.Uint16(buf),
+			ExternalAttrs:  le.Uint32(buf[34:]),
+		})
+
+		var sig [4]byte
+		if _, err := io.ReadFull(zs, sig[:]); err != nil {
+			return nil, fmt.Errorf("read zip directory: %w", noEOF(err))
+		}
+		if le.Uint32(sig[:]) != zipDirectoryHeaderSignature {
+			// 剩余的是 End of Central Directory 等，读取完以免写入方阻塞
+			_, _ = io.Copy(io.Discard, zs)
+			return headers, nil
+		}
+	}
+}
+
+// setStreamMeta 按照 Central Directory 中的信息，设置已解压的文件的权限，以及将符号链接从普通文件还原
+func (zp *Zip) setStreamMeta(headers []*zip.FileHeader, done map[string]string, targetDir string, dirs []zipDirMeta) error {
+	for _, h := range headers {
+		outPath, ok := done[h.Name]
+		if !ok {
+			continue
+		}
+		mode := h.Mode()
+		perm, hasPerm := zipPerm(h)
+		var err error
+		switch {
+		case mode.IsDir():
+			for i := range dirs {
+				if dirs[i].path == outPath && hasPerm {
+					dirs[i].mode = perm
+				}
+			}
+		case mode&os.ModeSymlink != 0:
+			err = restoreZipSymlink(h.Name, outPath, targetDir)
+		case mode.IsRegular() && hasPerm:
+			err = os.Chmod(outPath, perm)
+		}
+		if err != nil && !zp.IgnoreFailed {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreZipSymlink 将作为普通文件解压的符号链接还原，文件的内容是链接的目标
+func restoreZipSymlink(name string, outPath string, targetDir string) error {
+	f, err := os.Open(outPath)
+	if err != nil {
+		return err
+	}
+	link, err := readZipLink(name, f)
+	f.Close()
+	if err == nil {
+		err = createZipSymlink(name, link, outPath, targetDir)
+	}
+	if err != nil {
+		// 不保留内容是链接目标的普通文件
+		_ = os.Remove(outPath)
+	}
+	return err
+}
+
+// unpackSpilled 将剩余的数据写入临时文件后，使用 zip.Reader 解压剩余的文件
+//
+// raw 是已读取的当前文件的 Local File Header，start 是其在数据流中的位置。
+// 临时文件中 start 之前的部分不写入数据，以使 Central Directory 中记录的位置依然有效
+func (zp *Zip) unpackSpilled(zs *zipStreamReader, raw []byte, start int64, targetDir string, ul *unpackLimiter,
+	dirs []zipDirMeta, done map[string]string) error {
+	tf, err := os.CreateTemp("", "cmdutil-zip-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tf.Close()
+		os.Remove(tf.Name())
+	}()
+	if _, err = tf.WriteAt(raw, start); err != nil {
+		return err
+	}
+	if _, err = tf.Seek(start+int64(len(raw)), io.SeekStart); err != nil {
+		return err
+	}
+	n, err := io.Copy(tf, zs)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(tf, start+int64(len(raw))+n)
+	if err != nil {
+		return err
+	}
+
+	var files []*zip.File
+	var before []*zip.FileHeader
+	for _, f := range zr.File {
+		// start 之前的文件已经解压，其 Local File Header 没有写入临时文件，会读取失败
+		if offset, err := f.DataOffset(); err == nil && offset > start {
+			files = append(files, f)
+		} else {
+			before = append(before, &f.FileHeader)
+		}
+	}
+	if err = zp.setStreamMeta(before, done, targetDir, dirs); err != nil {
+		return err
+	}
+	if _, err = zp.unpackFiles(files, targetDir, ul, &dirs); err != nil {
+		return err
+	}
+	return zp.setDirMeta(dirs)
+}
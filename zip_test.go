@@ -0,0 +1,459 @@
+// Copyright(C) 2026 github.com/fsgo  All Rights Reserved.
+// Author: agent <agent@local>
+// Date: 2026/10/17
+
+package cmdutil
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xanygo/anygo/xt"
+)
+
+type testZipEntry struct {
+	name     string
+	body     string
+	mode     os.FileMode
+	modified time.Time
+	store    bool
+}
+
+func newTestZipReader(t *testing.T, entries []testZipEntry) *zip.Reader {
+	t.Helper()
+	data := newTestZipData(t, entries)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	xt.NoError(t, err)
+	return zr
+}
+
+func newTestZipData(t *testing.T, entries []testZipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.modified}
+		if e.store {
+			h.Method = zip.Store
+		}
+		if e.mode != 0 {
+			h.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(h)
+		xt.NoError(t, err)
+		_, err = w.Write([]byte(e.body))
+		xt.NoError(t, err)
+	}
+	xt.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestZip_UnpackUnsafePath(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	for _, name := range []string{"../../etc/x", "a/../../x", "/x", ".."} {
+		zp := &Zip{IgnoreFailed: true}
+		err := zp.UnpackFromReader(newTestZipReader(t, []testZipEntry{{name: name, body: "x"}}), out)
+		var ue *UnsafePathError
+		xt.True(t, errors.As(err, &ue))
+	}
+
+	zp := &Zip{}
+	zr := newTestZipReader(t, []testZipEntry{{name: "a/b.txt", body: "b"}})
+	xt.NoError(t, zp.UnpackFromReader(zr, out))
+	xt.Equal(t, "b", readTestFile(t, filepath.Join(out, "a", "b.txt")))
+}
+
+func TestZip_UnpackLimit(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "a/b/c.txt", body: "hello"},
+		{name: "d.txt", body: "world"},
+		{name: "zero", body: string(make([]byte, 4<<20))},
+	}
+	checkLimit := func(t *testing.T, limit UnpackLimit, want string) {
+		zp := &Zip{Limit: limit, IgnoreFailed: true}
+		err := zp.UnpackFromReader(newTestZipReader(t, entries), t.TempDir())
+		var le *LimitError
+		xt.True(t, errors.As(err, &le))
+		xt.Equal(t, want, le.Limit)
+	}
+	t.Run("entries", func(t *testing.T) {
+		checkLimit(t, UnpackLimit{MaxEntries: 2}, "MaxEntries")
+	})
+	t.Run("depth", func(t *testing.T) {
+		checkLimit(t, UnpackLimit{MaxDepth: 2}, "MaxDepth")
+	})
+	t.Run("total", func(t *testing.T) {
+		checkLimit(t, UnpackLimit{MaxTotalSize: 1 << 20}, "MaxTotalSize")
+	})
+	t.Run("ratio", func(t *testing.T) {
+		checkLimit(t, UnpackLimit{MaxRatio: 100}, "MaxRatio")
+	})
+	t.Run("ok", func(t *testing.T) {
+		zp := &Zip{Limit: UnpackLimit{MaxEntries: 3, MaxDepth: 3, MaxTotalSize: 5 << 20, MaxRatio: 10000}}
+		xt.NoError(t, zp.UnpackFromReader(newTestZipReader(t, entries), t.TempDir()))
+	})
+}
+
+func TestZip_UnpackMeta(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file mode and symlink are not supported on windows")
+	}
+	mt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	zr := newTestZipReader(t, []testZipEntry{
+		{name: "a/", mode: os.ModeDir | 0555, modified: mt},
+		{name: "a/run.sh", body: "#!/bin/sh", mode: 0755, modified: mt},
+		{name: "a/ro.txt", body: "ro", mode: 0400},
+		{name: "a/link", body: "run.sh", mode: os.ModeSymlink | 0777},
+		{name: "b.txt", body: "b"},
+	})
+	out := t.TempDir()
+	zp := &Zip{MinSize: 2}
+	xt.NoError(t, zp.UnpackFromReader(zr, out))
+	t.Cleanup(func() {
+		_ = os.Chmod(filepath.Join(out, "a"), 0755)
+	})
+
+	info, err := os.Stat(filepath.Join(out, "a"))
+	xt.NoError(t, err)
+	xt.Equal(t, os.FileMode(0555), info.Mode().Perm())
+	xt.True(t, info.ModTime().Equal(mt))
+
+	info, err = os.Stat(filepath.Join(out, "a", "run.sh"))
+	xt.NoError(t, err)
+	xt.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	xt.True(t, info.ModTime().Equal(mt))
+
+	info, err = os.Stat(filepath.Join(out, "a", "ro.txt"))
+	xt.NoError(t, err)
+	xt.Equal(t, os.FileMode(0400), info.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(out, "a", "link"))
+	xt.NoError(t, err)
+	xt.Equal(t, "run.sh", link)
+
+	// b.txt 小于 MinSize
+	_, err = os.Stat(filepath.Join(out, "b.txt"))
+	xt.True(t, os.IsNotExist(err))
+
+	t.Run("unsafe link", func(t *testing.T) {
+		zr := newTestZipReader(t, []testZipEntry{
+			{name: "link", body: "../../etc/passwd", mode: os.ModeSymlink | 0777},
+		})
+		err := (&Zip{}).UnpackFromReader(zr, t.TempDir())
+		var ue *UnsafePathError
+		xt.True(t, errors.As(err, &ue))
+	})
+}
+
+// newTestFATZipData 使用 zw.Create 创建 zip 包，其中没有 Unix 权限信息
+func newTestFATZipData(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	_, err := zw.Create("d/")
+	xt.NoError(t, err)
+	w, err := zw.Create("d/a.txt")
+	xt.NoError(t, err)
+	_, err = w.Write([]byte("a"))
+	xt.NoError(t, err)
+	xt.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// checkDefaultPerm 检查解压后的目录 d 和文件 d/a.txt 的权限，和直接创建的（受 umask 影响）一致
+func checkDefaultPerm(t *testing.T, out string) {
+	t.Helper()
+	ref := t.TempDir()
+	xt.NoError(t, os.WriteFile(filepath.Join(ref, "a.txt"), nil, 0666))
+	want, err := os.Stat(filepath.Join(ref, "a.txt"))
+	xt.NoError(t, err)
+	got, err := os.Stat(filepath.Join(out, "d", "a.txt"))
+	xt.NoError(t, err)
+	xt.Equal(t, want.Mode().Perm(), got.Mode().Perm())
+
+	xt.NoError(t, mkdir(filepath.Join(ref, "d")))
+	want, err = os.Stat(filepath.Join(ref, "d"))
+	xt.NoError(t, err)
+	got, err = os.Stat(filepath.Join(out, "d"))
+	xt.NoError(t, err)
+	xt.Equal(t, want.Mode().Perm(), got.Mode().Perm())
+}
+
+func TestZip_UnpackDefaultPerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file mode is not supported on windows")
+	}
+	data := newTestFATZipData(t)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	xt.NoError(t, err)
+	out := t.TempDir()
+	xt.NoError(t, (&Zip{}).UnpackFromReader(zr, out))
+	checkDefaultPerm(t, out)
+
+	out = t.TempDir()
+	xt.NoError(t, (&Zip{}).UnpackFromStream(bytes.NewReader(data), out))
+	checkDefaultPerm(t, out)
+}
+
+func TestZip_Pack(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "b.gz"), "gz")
+	writeTestFile(t, filepath.Join(src, "sub", "run.sh"), "#!/bin/sh")
+	writeTestFile(t, filepath.Join(src, "empty.txt"), "")
+	mt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	xt.NoError(t, os.Chtimes(filepath.Join(src, "a.txt"), mt, mt))
+	if runtime.GOOS != "windows" {
+		xt.NoError(t, os.Chmod(filepath.Join(src, "sub", "run.sh"), 0755))
+		xt.NoError(t, os.Symlink("a.txt", filepath.Join(src, "link")))
+	}
+
+	t.Run("pack and unpack", func(t *testing.T) {
+		zp := &Zip{
+			MinSize: 1,
+			PackMethod: func(h *zip.FileHeader) uint16 {
+				if strings.HasSuffix(h.Name, ".gz") {
+					return zip.Store
+				}
+				return zip.Deflate
+			},
+		}
+		archive := filepath.Join(dir, "out", "a.zip")
+		xt.NoError(t, zp.Pack(archive, src))
+
+		zr, err := zip.OpenReader(archive)
+		xt.NoError(t, err)
+		defer zr.Close()
+		methods := map[string]uint16{}
+		for _, f := range zr.File {
+			methods[f.Name] = f.Method
+		}
+		xt.Equal(t, zip.Store, methods["src/b.gz"])
+		xt.Equal(t, zip.Deflate, methods["src/a.txt"])
+		_, has := methods["src/empty.txt"]
+		xt.False(t, has)
+
+		out := filepath.Join(dir, "t1")
+		xt.NoError(t, (&Zip{}).Unpack(archive, out))
+		xt.Equal(t, "a", readTestFile(t, filepath.Join(out, "src", "a.txt")))
+		xt.Equal(t, "#!/bin/sh", readTestFile(t, filepath.Join(out, "src", "sub", "run.sh")))
+		info, err := os.Stat(filepath.Join(out, "src", "a.txt"))
+		xt.NoError(t, err)
+		xt.True(t, info.ModTime().Equal(mt))
+		if runtime.GOOS != "windows" {
+			info, err = os.Stat(filepath.Join(out, "src", "sub", "run.sh"))
+			xt.NoError(t, err)
+			xt.Equal(t, os.FileMode(0755), info.Mode().Perm())
+			link, err := os.Readlink(filepath.Join(out, "src", "link"))
+			xt.NoError(t, err)
+			xt.Equal(t, "a.txt", link)
+		}
+	})
+
+	t.Run("strip and prefix", func(t *testing.T) {
+		var names []string
+		zp := &Zip{
+			StripComponents: 1,
+			PackPrefix:      "tool",
+			PackNextBefore: func(h *zip.FileHeader) (skip bool, err error) {
+				return h.Name == "tool/sub/" || h.Name == "tool/link", nil
+			},
+			PackNextAfter: func(h *zip.FileHeader, err error) error {
+				names = append(names, h.Name)
+				return err
+			},
+		}
+		archive := filepath.Join(dir, "out", "b.zip")
+		xt.NoError(t, zp.Pack(archive, src))
+		xt.Equal(t, []string{"tool/a.txt", "tool/b.gz", "tool/empty.txt"}, names)
+	})
+
+	t.Run("archive in src", func(t *testing.T) {
+		archive := filepath.Join(src, "self.zip")
+		xt.NoError(t, (&Zip{}).Pack(archive, filepath.Join(src, "sub")))
+		xt.NoError(t, (&Zip{}).Pack(archive, src))
+		zr, err := zip.OpenReader(archive)
+		xt.NoError(t, err)
+		defer zr.Close()
+		for _, f := range zr.File {
+			xt.NotEqual(t, "src/self.zip", f.Name)
+		}
+	})
+}
+
+func TestZip_UnpackFromStream(t *testing.T) {
+	mt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []testZipEntry{
+		{name: "a/", mode: os.ModeDir | 0750, modified: mt},
+		{name: "a/run.sh", body: "#!/bin/sh", mode: 0755, modified: mt},
+		{name: "a/link", body: "run.sh", mode: os.ModeSymlink | 0777},
+		{name: "a/big.txt", body: strings.Repeat("hello", 10000)},
+		{name: "b.txt", body: "b"},
+	}
+	check := func(t *testing.T, out string) {
+		xt.Equal(t, "#!/bin/sh", readTestFile(t, filepath.Join(out, "a", "run.sh")))
+		xt.Equal(t, strings.Repeat("hello", 10000), readTestFile(t, filepath.Join(out, "a", "big.txt")))
+		xt.Equal(t, "b", readTestFile(t, filepath.Join(out, "b.txt")))
+		info, err := os.Stat(filepath.Join(out, "a", "run.sh"))
+		xt.NoError(t, err)
+		xt.True(t, info.ModTime().Equal(mt))
+		if runtime.GOOS == "windows" {
+			return
+		}
+		xt.Equal(t, os.FileMode(0755), info.Mode().Perm())
+		info, err = os.Stat(filepath.Join(out, "a"))
+		xt.NoError(t, err)
+		xt.Equal(t, os.FileMode(0750), info.Mode().Perm())
+		link, err := os.Readlink(filepath.Join(out, "a", "link"))
+		xt.NoError(t, err)
+		xt.Equal(t, "run.sh", link)
+	}
+
+	t.Run("deflate", func(t *testing.T) {
+		data := newTestZipData(t, entries)
+		out := t.TempDir()
+		// 使用 struct 包装，以去掉 bytes.Reader 的 ReadAt 和 Seek 方法
+		xt.NoError(t, (&Zip{}).UnpackFromStream(struct{ io.Reader }{bytes.NewReader(data)}, out))
+		check(t, out)
+	})
+
+	t.Run("store", func(t *testing.T) {
+		// 未压缩的文件使用 Data Descriptor 时，需要写入临时文件
+		es := append([]testZipEntry{}, entries...)
+		es[2].store = true
+		var names []string
+		zp := &Zip{
+			UnpackNextBefore: func(f *zip.File) (skip bool, err error) {
+				names = append(names, f.Name)
+				return false, nil
+			},
+		}
+		out := t.TempDir()
+		xt.NoError(t, zp.UnpackFromStream(struct{ io.Reader }{bytes.NewReader(newTestZipData(t, es))}, out))
+		xt.Equal(t, []string{"a/", "a/run.sh", "a/link", "a/big.txt", "b.txt"}, names)
+		check(t, out)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		xt.NoError(t, (&Zip{}).UnpackFromStream(bytes.NewReader(newTestZipData(t, nil)), t.TempDir()))
+	})
+
+	t.Run("min max size", func(t *testing.T) {
+		// zip.Writer 创建的文件都使用 Data Descriptor，Local File Header 中的大小为 0
+		data := newTestZipData(t, []testZipEntry{
+			{name: "a_small.txt", body: "abc"},
+			{name: "b_mid.txt", body: strings.Repeat("m", 100)},
+			{name: "c_big.txt", body: strings.Repeat("b", 10000)},
+		})
+		list := func(out string) []string {
+			entries, err := os.ReadDir(out)
+			xt.NoError(t, err)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			return names
+		}
+		for _, zp := range []*Zip{{MinSize: 10}, {MaxSize: 1000}, {MinSize: 10, MaxSize: 1000}} {
+			want := t.TempDir()
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			xt.NoError(t, err)
+			xt.NoError(t, zp.UnpackFromReader(zr, want))
+
+			var after []string
+			zp.UnpackNextAfter = func(f *zip.File, err error) error {
+				after = append(after, f.Name)
+				return err
+			}
+			out := t.TempDir()
+			xt.NoError(t, zp.UnpackFromStream(struct{ io.Reader }{bytes.NewReader(data)}, out))
+			xt.Equal(t, list(want), list(out))
+			xt.Equal(t, list(out), after)
+		}
+		out := t.TempDir()
+		xt.NoError(t, (&Zip{MinSize: 10, MaxSize: 1000}).UnpackFromStream(bytes.NewReader(data), out))
+		xt.Equal(t, []string{"b_mid.txt"}, list(out))
+	})
+
+	t.Run("unsafe", func(t *testing.T) {
+		data := newTestZipData(t, []testZipEntry{
+			{name: "../x", body: "x"},
+		})
+		err := (&Zip{}).UnpackFromStream(bytes.NewReader(data), t.TempDir())
+		var ue *UnsafePathError
+		xt.True(t, errors.As(err, &ue))
+
+		data = newTestZipData(t, []testZipEntry{
+			{name: "link", body: "../../etc/passwd", mode: os.ModeSymlink | 0777},
+		})
+		out := t.TempDir()
+		err = (&Zip{}).UnpackFromStream(bytes.NewReader(data), out)
+		xt.True(t, errors.As(err, &ue))
+		_, err = os.Lstat(filepath.Join(out, "link"))
+		xt.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		data := newTestZipData(t, entries)
+		err := (&Zip{}).UnpackFromStream(bytes.NewReader(data[:len(data)/2]), t.TempDir())
+		xt.Error(t, err)
+	})
+}
+
+func Test_readZipDataDescriptor(t *testing.T) {
+	le := binary.LittleEndian
+	// Go 的 zip.Writer 流式写入超过 4GB 的文件时，Local File Header 中没有 Zip64 Extra，
+	// Data Descriptor 中的大小为 8 字节
+	h := &zip.FileHeader{Name: "big.bin", Flags: 0x8}
+	xt.False(t, isZip64Descriptor(h, 100, 200))
+	xt.True(t, isZip64Descriptor(h, 1<<32-1, 200))
+	xt.True(t, isZip64Descriptor(h, 100, 5<<30))
+
+	desc := le.AppendUint32(nil, zipDataDescriptorSignature)
+	desc = le.AppendUint32(desc, 0x12345678)
+	desc = le.AppendUint64(desc, 4<<30+1)
+	desc = le.AppendUint64(desc, 5<<30)
+	for _, data := range [][]byte{desc, desc[4:]} {
+		zs := &zipStreamReader{br: bufio.NewReader(bytes.NewReader(append(data, "next"...)))}
+		xt.NoError(t, readZipDataDescriptor(zs, h, true))
+		xt.Equal(t, uint32(0x12345678), h.CRC32)
+		xt.Equal(t, uint64(4<<30+1), h.CompressedSize64)
+		xt.Equal(t, uint64(5<<30), h.UncompressedSize64)
+		// 之后的数据不能被读取
+		xt.Equal(t, int64(len(data)), zs.n)
+	}
+}
+
+func TestZip_List(t *testing.T) {
+	mt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	zr := newTestZipReader(t, []testZipEntry{
+		{name: "pkg/", mode: os.ModeDir | 0755},
+		{name: "pkg/tool", body: "tool", mode: 0755, modified: mt},
+		{name: "pkg/t", body: "tool", mode: os.ModeSymlink | 0777},
+		{name: "pkg/README", body: "r"},
+	})
+	zp := &Zip{StripComponents: 1, MinSize: 2}
+	list, err := zp.ListFromReader(zr)
+	xt.NoError(t, err)
+	xt.Equal(t, 2, len(list))
+	xt.Equal(t, "tool", list[0].Path)
+	xt.Equal(t, EntryFile, list[0].Type)
+	xt.Equal(t, os.FileMode(0755), list[0].Mode)
+	xt.Equal(t, int64(4), list[0].Size)
+	xt.True(t, list[0].ModTime.Equal(mt))
+	xt.Equal(t, "t", list[1].Path)
+	xt.Equal(t, EntrySymlink, list[1].Type)
+	xt.Equal(t, "tool", list[1].Linkname)
+}